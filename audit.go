@@ -0,0 +1,370 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// the kinds of the audit sinks
+const (
+	auditSinkNone      = "none"
+	auditSinkStdout    = "stdout"
+	auditSinkJSONLines = "jsonl"
+	auditSinkSQLite    = "sqlite"
+)
+
+// the values of the fields of auditRecord
+const (
+	auditTargetPR    = "pr"
+	auditTargetIssue = "issue"
+
+	auditActionAdd    = "add"
+	auditActionRemove = "remove"
+
+	// auditTriggerCommand is a label command comment
+	auditTriggerCommand = "command"
+	// auditTriggerSourceUpdate is a push to the source branch of the PR
+	auditTriggerSourceUpdate = "source_update"
+	// auditTriggerSquash is the check of the number of the commits of the PR
+	auditTriggerSquash = "squash"
+)
+
+// auditRecord is a label mutation performed by the bot
+type auditRecord struct {
+	Time   time.Time `json:"time"`
+	Org    string    `json:"org"`
+	Repo   string    `json:"repo"`
+	Number string    `json:"number"`
+	Target string    `json:"target"`
+	Action string    `json:"action"`
+	Labels []string  `json:"labels"`
+	// Actor is the login name of the commenter or the pusher, it is empty if the bot acts on its own
+	Actor   string `json:"actor,omitempty"`
+	Trigger string `json:"trigger"`
+	// CommentID and Comment are the label command comment which triggers the mutation
+	CommentID string `json:"comment_id,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+	Success   bool   `json:"success"`
+}
+
+func (r *auditRecord) String() string {
+	outcome := "succeeded"
+	if !r.Success {
+		outcome = "failed"
+	}
+
+	by := "the bot"
+	if r.Actor != "" {
+		by = r.Actor
+	}
+
+	trigger := r.Trigger
+	if r.CommentID != "" {
+		trigger += " " + r.CommentID
+	}
+
+	return fmt.Sprintf("%s %s %s by %s (%s) %s", r.Time.Format(time.RFC3339), r.Action,
+		strings.Join(r.Labels, ", "), by, trigger, outcome)
+}
+
+// auditSink stores the audit records
+type auditSink interface {
+	Record(r *auditRecord) error
+	// Query returns the records of the PR or issue in order
+	Query(org, repo, number string) ([]auditRecord, error)
+	Close() error
+}
+
+// newAuditSink creates the sink of the kind, path is the file of the jsonl and sqlite sinks.
+// It returns nil if the kind is none or empty, the mutations are not recorded then.
+func newAuditSink(kind, path string) (auditSink, error) {
+	switch kind {
+	case "", auditSinkNone:
+		return nil, nil
+	case auditSinkStdout:
+		return &writerSink{w: os.Stdout}, nil
+	}
+
+	if path == "" {
+		return nil, errors.New("missing the path of the audit sink " + kind)
+	}
+
+	switch kind {
+	case auditSinkJSONLines:
+		return &jsonLinesSink{path: path}, nil
+	case auditSinkSQLite:
+		return newSQLiteSink(path)
+	}
+
+	return nil, errors.New("unsupported audit sink: " + kind)
+}
+
+// writerSink writes the records as json lines to a stream, e.g. stdout, it can not be queried.
+type writerSink struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func (s *writerSink) Record(r *auditRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+func (s *writerSink) Query(org, repo, number string) ([]auditRecord, error) {
+	return nil, errors.New("the records written to a stream can not be queried")
+}
+
+func (s *writerSink) Close() error {
+	return nil
+}
+
+// jsonLinesSink appends the records to a file as json lines
+type jsonLinesSink struct {
+	lock sync.Mutex
+	path string
+}
+
+func (s *jsonLinesSink) Record(r *auditRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func (s *jsonLinesSink) Query(org, repo, number string) ([]auditRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []auditRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var r auditRecord
+		if err = json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", s.path, line, err)
+		}
+		if r.Org == org && r.Repo == repo && r.Number == number {
+			records = append(records, r)
+		}
+	}
+
+	return records, scanner.Err()
+}
+
+func (s *jsonLinesSink) Close() error {
+	return nil
+}
+
+// sqliteSink stores the records in a table of a SQLite database
+type sqliteSink struct {
+	db *sql.DB
+}
+
+const sqliteAuditSchema = `CREATE TABLE IF NOT EXISTS label_audit (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	time       TEXT NOT NULL,
+	org        TEXT NOT NULL,
+	repo       TEXT NOT NULL,
+	number     TEXT NOT NULL,
+	target     TEXT NOT NULL,
+	action     TEXT NOT NULL,
+	labels     TEXT NOT NULL,
+	actor      TEXT NOT NULL,
+	trigger    TEXT NOT NULL,
+	comment_id TEXT NOT NULL,
+	comment    TEXT NOT NULL,
+	success    INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS label_audit_pr ON label_audit (org, repo, number);`
+
+func newSQLiteSink(path string) (*sqliteSink, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.Exec(sqliteAuditSchema); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &sqliteSink{db: db}, nil
+}
+
+func (s *sqliteSink) Record(r *auditRecord) error {
+	labels, err := json.Marshal(r.Labels)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`INSERT INTO label_audit
+		(time, org, repo, number, target, action, labels, actor, trigger, comment_id, comment, success)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.Time.Format(time.RFC3339Nano), r.Org, r.Repo, r.Number, r.Target, r.Action, string(labels),
+		r.Actor, r.Trigger, r.CommentID, r.Comment, r.Success)
+
+	return err
+}
+
+func (s *sqliteSink) Query(org, repo, number string) ([]auditRecord, error) {
+	rows, err := s.db.Query(`SELECT time, org, repo, number, target, action, labels, actor, trigger,
+		comment_id, comment, success FROM label_audit WHERE org = ? AND repo = ? AND number = ? ORDER BY id`,
+		org, repo, number)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []auditRecord
+	for rows.Next() {
+		var r auditRecord
+		var t, labels string
+		if err = rows.Scan(&t, &r.Org, &r.Repo, &r.Number, &r.Target, &r.Action, &labels, &r.Actor,
+			&r.Trigger, &r.CommentID, &r.Comment, &r.Success); err != nil {
+			return nil, err
+		}
+		if r.Time, err = time.Parse(time.RFC3339Nano, t); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(labels), &r.Labels); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+
+	return records, rows.Err()
+}
+
+func (s *sqliteSink) Close() error {
+	return s.db.Close()
+}
+
+// audit records a label mutation to the metrics and the audit sink if there is one.
+// The mutations intercepted in the dry-run mode are not recorded, they are logged by dryRunClient.
+func (bot *robot) audit(r auditRecord) {
+	if bot.dryRun(r.Org, r.Repo) {
+		return
+	}
+
+	bot.metrics.observeMutation(&r)
+	if bot.auditor == nil {
+		return
+	}
+
+	r.Time = time.Now().UTC()
+	if err := bot.auditor.Record(&r); err != nil {
+		bot.log.WithError(err).Errorf("failed to record the audit of %s/%s/%s", r.Org, r.Repo, r.Number)
+	}
+}
+
+// auditRecord builds the record of a label mutation triggered by the command of the report
+func (r *commandReport) auditRecord(target, action string, labels []string, success bool) auditRecord {
+	return auditRecord{
+		Org:       r.Org,
+		Repo:      r.Repo,
+		Number:    r.Number,
+		Target:    target,
+		Action:    action,
+		Labels:    labels,
+		Actor:     r.commenter,
+		Trigger:   auditTriggerCommand,
+		CommentID: r.commentID,
+		Comment:   r.comment,
+		Success:   success,
+	}
+}
+
+// queryAudit prints the label history of a PR or issue recorded in the audit sink, it returns the exit code.
+//
+//	robot-universal-label audit --audit-sink=jsonl --audit-path=audit.jsonl org/repo number
+func queryAudit(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	fs.SetOutput(out)
+	kind := fs.String("audit-sink", auditSinkJSONLines, "The kind of the audit sink, it is jsonl or sqlite.")
+	path := fs.String("audit-path", "", "Path to the file of the audit sink.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	org, repo, ok := strings.Cut(fs.Arg(0), "/")
+	if !ok || org == "" || repo == "" || fs.Arg(1) == "" || fs.NArg() > 2 {
+		_, _ = fmt.Fprintln(out, "usage: audit --audit-sink=jsonl --audit-path=audit.jsonl org/repo number")
+		return 2
+	}
+
+	sink, err := newAuditSink(*kind, *path)
+	if err == nil && sink == nil {
+		err = errors.New("no audit sink to query")
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(out, err)
+		return 1
+	}
+	defer sink.Close()
+
+	records, err := sink.Query(org, repo, fs.Arg(1))
+	if err != nil {
+		_, _ = fmt.Fprintln(out, err)
+		return 1
+	}
+
+	for i := range records {
+		_, _ = fmt.Fprintln(out, records[i].String())
+	}
+
+	return 0
+}
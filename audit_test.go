@@ -0,0 +1,94 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"github.com/opensourceways/robot-framework-lib/framework"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditSinks(t *testing.T) {
+	dir := t.TempDir()
+	for _, kind := range []string{auditSinkJSONLines, auditSinkSQLite} {
+		sink, err := newAuditSink(kind, filepath.Join(dir, "audit."+kind))
+		assert.Nil(t, err)
+
+		records := []auditRecord{
+			{Org: org, Repo: repo, Number: number, Target: auditTargetPR, Action: auditActionAdd,
+				Labels: []string{"kind/bug"}, Actor: "alice", Trigger: auditTriggerCommand, CommentID: "1", Comment: "/kind bug", Success: true},
+			{Org: org, Repo: repo, Number: "2", Target: auditTargetPR, Action: auditActionAdd,
+				Labels: []string{"lgtm"}, Trigger: auditTriggerCommand, Success: true},
+			{Org: org, Repo: repo, Number: number, Target: auditTargetPR, Action: auditActionRemove,
+				Labels: []string{"kind/bug", "lgtm"}, Actor: "bob", Trigger: auditTriggerSourceUpdate},
+		}
+		for i := range records {
+			assert.Nil(t, sink.Record(&records[i]))
+		}
+
+		history, err := sink.Query(org, repo, number)
+		assert.Nil(t, err, kind)
+		assert.Equal(t, []auditRecord{records[0], records[2]}, history, kind)
+		assert.Nil(t, sink.Close())
+	}
+
+	sink, err := newAuditSink(auditSinkNone, "")
+	assert.Nil(t, sink)
+	assert.Nil(t, err)
+	_, err = newAuditSink(auditSinkJSONLines, "")
+	assert.EqualError(t, err, "missing the path of the audit sink jsonl")
+	_, err = newAuditSink("kafka", "topic")
+	assert.EqualError(t, err, "unsupported audit sink: kafka")
+}
+
+func TestAuditLabelMutations(t *testing.T) {
+	var out bytes.Buffer
+	cli := &mockClient{successfulAddPRLabels: true}
+	bot := &robot{cli: cli, log: framework.NewLogger(), auditor: &writerSink{w: &out}}
+
+	report := &commandReport{commentData: commentData{Org: org, Repo: repo, Number: number, Commenter: "@alice"},
+		commenter: "alice", commentID: "7", comment: "/kind bug\n/remove-lgtm"}
+	bot.addPRLabels(org, repo, number, []string{"kind/bug"}, report)
+	bot.removePRLabels(org, repo, number, []string{"lgtm"}, report)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.Contains(t, lines[0], `"action":"add","labels":["kind/bug"],"actor":"alice","trigger":"command","comment_id":"7"`)
+	assert.Contains(t, lines[0], `"success":true`)
+	assert.Contains(t, lines[1], `"action":"remove","labels":["lgtm"]`)
+	assert.Contains(t, lines[1], `"success":false`)
+}
+
+func TestQueryAudit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink := &jsonLinesSink{path: path}
+	assert.Nil(t, sink.Record(&auditRecord{Org: org, Repo: repo, Number: number, Action: auditActionAdd,
+		Labels: []string{"kind/bug"}, Actor: "alice", Trigger: auditTriggerCommand, CommentID: "7", Success: true}))
+	assert.Nil(t, sink.Record(&auditRecord{Org: org, Repo: repo, Number: number, Action: auditActionAdd,
+		Labels: []string{"squash"}, Trigger: auditTriggerSquash}))
+
+	var out bytes.Buffer
+	assert.Equal(t, 0, queryAudit([]string{"--audit-path=" + path, org + "/" + repo, number}, &out))
+	assert.Equal(t, "0001-01-01T00:00:00Z add kind/bug by alice (command 7) succeeded\n"+
+		"0001-01-01T00:00:00Z add squash by the bot (squash) failed\n", out.String())
+
+	out.Reset()
+	assert.Equal(t, 2, queryAudit([]string{"--audit-path=" + path, org}, &out))
+	out.Reset()
+	assert.Equal(t, 1, queryAudit([]string{"--audit-sink=none", org + "/" + repo, number}, &out))
+	assert.Equal(t, "no audit sink to query\n", out.String())
+}
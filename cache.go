@@ -0,0 +1,324 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the caches of the reads
+const (
+	cacheRepoLabels  = "repo_labels"
+	cachePermissions = "permissions"
+)
+
+// the headers of the event types of the webhooks of the platforms
+var headersEventType = []string{headerEventType, "X-GitHub-Event", "X-Gitee-Event", "X-Gitlab-Event"}
+
+// the lowercased event types of the webhooks which change the labels of the repositories,
+// Gitee sends no such webhooks.
+var labelEventTypes = []string{
+	// GitHub
+	"label",
+	// GitCode and GitLab
+	"label hook",
+}
+
+// the lowercased event types of the webhooks which change the permissions of the users,
+// Gitee sends no such webhooks.
+var memberEventTypes = []string{
+	// GitHub: the collaborators, the members of the orgs and the teams, and the teams of the repositories
+	"member", "membership", "organization", "team", "team_add",
+	// GitCode and GitLab: the members of the projects and the groups
+	"member hook",
+}
+
+type cacheEntry[T any] struct {
+	value   T
+	expires time.Time
+}
+
+// readCache caches the labels of the repositories and the permissions of the users for a while,
+// it is shared by the clients of all the credentials. A nil readCache caches nothing.
+type readCache struct {
+	ttl     time.Duration
+	now     func() time.Time
+	metrics *robotMetrics
+
+	lock sync.Mutex
+	// repoLabels are keyed by org/repo, permissions are keyed by org/repo/user
+	repoLabels  map[string]cacheEntry[[]string]
+	permissions map[string]cacheEntry[bool]
+	// swept is when the expired entries were swept last
+	swept time.Time
+}
+
+func newReadCache(ttl time.Duration, metrics *robotMetrics) *readCache {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return &readCache{
+		ttl:         ttl,
+		now:         time.Now,
+		metrics:     metrics,
+		repoLabels:  map[string]cacheEntry[[]string]{},
+		permissions: map[string]cacheEntry[bool]{},
+	}
+}
+
+// lookup returns the value of the key if it is cached and not expired
+func lookup[T any](c *readCache, cache string, entries map[string]cacheEntry[T], key string) (T, bool) {
+	c.lock.Lock()
+	e, ok := entries[key]
+	hit := ok && c.now().Before(e.expires)
+	if ok && !hit {
+		delete(entries, key)
+	}
+	c.lock.Unlock()
+
+	c.metrics.observeCacheLookup(cache, hit)
+
+	return e.value, hit
+}
+
+// store caches the value of the key. The expired entries which are not looked up again are swept
+// at most once per ttl, so that the caches only hold the entries stored within the last two ttls.
+func store[T any](c *readCache, entries map[string]cacheEntry[T], key string, value T) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := c.now()
+	if now.Sub(c.swept) >= c.ttl {
+		sweep(c.repoLabels, now)
+		sweep(c.permissions, now)
+		c.swept = now
+	}
+	entries[key] = cacheEntry[T]{value: value, expires: now.Add(c.ttl)}
+}
+
+// sweep drops the expired entries
+func sweep[T any](entries map[string]cacheEntry[T], now time.Time) {
+	for k, e := range entries {
+		if !now.Before(e.expires) {
+			delete(entries, k)
+		}
+	}
+}
+
+// invalidate drops the entries of the key and the ones under it, e.g. org drops org/repo as well
+func invalidate[T any](c *readCache, entries map[string]cacheEntry[T], key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for k := range entries {
+		if k == key || strings.HasPrefix(k, key+"/") {
+			delete(entries, k)
+		}
+	}
+}
+
+// invalidateRepoLabels drops the labels of the repository, or of all the repositories of the org if repo is empty
+func (c *readCache) invalidateRepoLabels(org, repo string) {
+	if c != nil {
+		invalidate(c, c.repoLabels, strings.TrimSuffix(org+"/"+repo, "/"))
+	}
+}
+
+// invalidatePermissions drops the permissions of the repository, or of all the repositories of the org if repo is empty
+func (c *readCache) invalidatePermissions(org, repo string) {
+	if c != nil {
+		invalidate(c, c.permissions, strings.TrimSuffix(org+"/"+repo, "/"))
+	}
+}
+
+// the headers which the platforms sign the webhooks by, or carry the secret of the webhooks in
+const (
+	headerGitCodeSignature = "X-GitCode-Signature-256"
+	headerGitHubSignature  = "X-Hub-Signature-256"
+	headerGiteeToken       = "X-Gitee-Token"
+	headerGiteeTimestamp   = "X-Gitee-Timestamp"
+	headerGitLabToken      = "X-Gitlab-Token"
+)
+
+// verifyWebhook returns true if the webhook is sent with the secret, in the way of the platform which sends it.
+// GitCode and GitHub sign the payload by HMAC, Gitee sends the secret or signs the timestamp, GitLab sends the secret.
+func verifyWebhook(r *http.Request, payload, secret []byte) bool {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	signature := []byte("sha256=" + hex.EncodeToString(mac.Sum(nil)))
+	for _, h := range []string{headerGitCodeSignature, headerGitHubSignature} {
+		if v := r.Header.Get(h); v != "" {
+			return hmac.Equal([]byte(v), signature)
+		}
+	}
+
+	if v := r.Header.Get(headerGiteeToken); v != "" {
+		if hmac.Equal([]byte(v), secret) {
+			return true
+		}
+		timestamp := r.Header.Get(headerGiteeTimestamp)
+		mac = hmac.New(sha256.New, secret)
+		mac.Write([]byte(timestamp + "\n" + string(secret)))
+		return timestamp != "" && hmac.Equal([]byte(v), []byte(base64.StdEncoding.EncodeToString(mac.Sum(nil))))
+	}
+
+	if v := r.Header.Get(headerGitLabToken); v != "" {
+		return hmac.Equal([]byte(v), secret)
+	}
+
+	return false
+}
+
+// handler invalidates the caches by the label and the member webhook events of the platforms,
+// which the framework does not dispatch. The labels or the permissions of the repository of the event are dropped,
+// or the ones of all the repositories of the org if the event is of the org.
+// The webhooks which are not sent with the secret are rejected.
+func (c *readCache) handler(secret []byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !verifyWebhook(r, body, secret) {
+			http.Error(w, "the secret of the webhook is invalid", http.StatusUnauthorized)
+			return
+		}
+
+		var eventType string
+		for _, h := range headersEventType {
+			if eventType = strings.ToLower(r.Header.Get(h)); eventType != "" {
+				break
+			}
+		}
+
+		var payload struct {
+			Repository struct {
+				FullName          string `json:"full_name"`
+				PathWithNamespace string `json:"path_with_namespace"`
+			} `json:"repository"`
+			Project struct {
+				PathWithNamespace string `json:"path_with_namespace"`
+			} `json:"project"`
+			Organization struct {
+				Login string `json:"login"`
+			} `json:"organization"`
+			// GroupPath is the group of the member webhooks of the groups of GitLab
+			GroupPath string `json:"group_path"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		org, repo := payload.Organization.Login, ""
+		if org == "" {
+			org = payload.GroupPath
+		}
+		for _, fullName := range []string{
+			payload.Repository.FullName, payload.Repository.PathWithNamespace, payload.Project.PathWithNamespace,
+		} {
+			// the namespaces of GitLab are nested, the repository is the last part
+			if i := strings.LastIndex(fullName, "/"); i > 0 {
+				org, repo = fullName[:i], fullName[i+1:]
+				break
+			}
+		}
+		if org == "" {
+			return
+		}
+
+		if slices.Contains(labelEventTypes, eventType) {
+			c.invalidateRepoLabels(org, repo)
+		}
+		if slices.Contains(memberEventTypes, eventType) {
+			c.invalidatePermissions(org, repo)
+		}
+	})
+}
+
+// cachingClient answers GetRepoIssueLabels and CheckPermission from the cache, the labels of the repository
+// are dropped when the bot adds the labels which the repository does not have, since they are created.
+type cachingClient struct {
+	iClient
+	cache *readCache
+}
+
+func (c *cachingClient) GetRepoIssueLabels(org, repo string) ([]string, bool) {
+	key := org + "/" + repo
+	if labels, ok := lookup(c.cache, cacheRepoLabels, c.cache.repoLabels, key); ok {
+		return slices.Clone(labels), true
+	}
+
+	labels, success := c.iClient.GetRepoIssueLabels(org, repo)
+	if success {
+		store(c.cache, c.cache.repoLabels, key, slices.Clone(labels))
+	}
+
+	return labels, success
+}
+
+func (c *cachingClient) CheckPermission(org, repo, username string) (bool, bool) {
+	key := org + "/" + repo + "/" + username
+	if pass, ok := lookup(c.cache, cachePermissions, c.cache.permissions, key); ok {
+		return pass, true
+	}
+
+	pass, success := c.iClient.CheckPermission(org, repo, username)
+	if success {
+		store(c.cache, c.cache.permissions, key, pass)
+	}
+
+	return pass, success
+}
+
+func (c *cachingClient) AddIssueLabels(org, repo, number string, labels []string) bool {
+	defer c.dropCreatedLabels(org, repo, labels)
+	return c.iClient.AddIssueLabels(org, repo, number, labels)
+}
+
+func (c *cachingClient) AddPRLabels(org, repo, number string, labels []string) bool {
+	defer c.dropCreatedLabels(org, repo, labels)
+	return c.iClient.AddPRLabels(org, repo, number, labels)
+}
+
+// dropCreatedLabels drops the labels of the repository if some of the labels added are not in them,
+// they may be created by adding them.
+func (c *cachingClient) dropCreatedLabels(org, repo string, labels []string) {
+	key := org + "/" + repo
+	c.cache.lock.Lock()
+	e, ok := c.cache.repoLabels[key]
+	c.cache.lock.Unlock()
+	if !ok {
+		return
+	}
+
+	for _, l := range labels {
+		if !slices.Contains(e.value, l) {
+			c.cache.invalidateRepoLabels(org, repo)
+			return
+		}
+	}
+}
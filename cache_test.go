@@ -0,0 +1,224 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/opensourceways/robot-universal-label/fakeclient"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCachingClient(t *testing.T) {
+	fake := fakeclient.New()
+	r := fake.AddRepo("owner", "repo1", "kind/bug")
+	r.Collaborators = []string{"alice"}
+	r.OpenPR(number)
+	fake.AddRepo("owner", "repo2", "kind/bug")
+
+	m := newRobotMetrics()
+	cache := newReadCache(time.Minute, m)
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	cli := &cachingClient{iClient: fake, cache: cache}
+	calls := func(method string) int {
+		n := 0
+		for _, c := range fake.Calls() {
+			if c.Method == method {
+				n++
+			}
+		}
+		return n
+	}
+
+	// the reads are cached
+	for i := 0; i < 3; i++ {
+		labels, ok := cli.GetRepoIssueLabels("owner", "repo1")
+		assert.True(t, ok)
+		assert.Equal(t, []string{"kind/bug"}, labels)
+		pass, ok := cli.CheckPermission("owner", "repo1", "alice")
+		assert.True(t, ok)
+		assert.True(t, pass)
+	}
+	assert.Equal(t, 1, calls("GetRepoIssueLabels"))
+	assert.Equal(t, 1, calls("CheckPermission"))
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.cacheRequests.WithLabelValues(cacheRepoLabels, "hit")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.cacheRequests.WithLabelValues(cachePermissions, "miss")))
+
+	// the labels which exist do not drop the cache, the created ones do
+	assert.True(t, cli.AddPRLabels("owner", "repo1", number, []string{"kind/bug"}))
+	cli.GetRepoIssueLabels("owner", "repo1")
+	assert.Equal(t, 1, calls("GetRepoIssueLabels"))
+	assert.True(t, cli.AddPRLabels("owner", "repo1", number, []string{"sig/doc"}))
+	labels, _ := cli.GetRepoIssueLabels("owner", "repo1")
+	assert.Equal(t, []string{"kind/bug", "sig/doc"}, labels)
+	assert.Equal(t, 2, calls("GetRepoIssueLabels"))
+
+	// the failed reads are not cached
+	fake.Fail("CheckPermission")
+	_, ok := cli.CheckPermission("owner", "repo1", "bob")
+	assert.False(t, ok)
+	fake.Recover("CheckPermission")
+	_, ok = cli.CheckPermission("owner", "repo1", "bob")
+	assert.True(t, ok)
+	assert.Equal(t, 3, calls("CheckPermission"))
+
+	// the entries expire
+	now = now.Add(time.Minute)
+	cli.CheckPermission("owner", "repo1", "alice")
+	assert.Equal(t, 4, calls("CheckPermission"))
+
+	// the webhook events of the labels and the members drop the caches
+	cli.GetRepoIssueLabels("owner", "repo2")
+	assert.Equal(t, 3, calls("GetRepoIssueLabels"))
+	// the webhooks are sent with signKey, and verified by secret
+	secret := []byte("secret")
+	signKey := secret
+	post := func(header, eventType, payload string) int {
+		req := httptest.NewRequest(http.MethodPost, "/cache-events", strings.NewReader(payload))
+		req.Header.Set(header, eventType)
+		if header == "X-Gitlab-Event" {
+			req.Header.Set(headerGitLabToken, string(signKey))
+		} else {
+			mac := hmac.New(sha256.New, signKey)
+			mac.Write([]byte(payload))
+			req.Header.Set(headerGitHubSignature, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		}
+		w := httptest.NewRecorder()
+		cache.handler(secret).ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, post("X-GitHub-Event", "label", `{"repository": {"full_name": "owner/repo1"}}`))
+	cli.GetRepoIssueLabels("owner", "repo1")
+	cli.GetRepoIssueLabels("owner", "repo2")
+	assert.Equal(t, 4, calls("GetRepoIssueLabels"))
+
+	assert.Equal(t, http.StatusOK, post("X-Gitlab-Event", "Member Hook", `{"project": {"path_with_namespace": "owner/repo1"}}`))
+	cli.CheckPermission("owner", "repo1", "alice")
+	assert.Equal(t, 5, calls("CheckPermission"))
+
+	// the event of the org drops the caches of all its repositories
+	assert.Equal(t, http.StatusOK, post("X-GitHub-Event", "label", `{"organization": {"login": "owner"}}`))
+	cli.GetRepoIssueLabels("owner", "repo1")
+	cli.GetRepoIssueLabels("owner", "repo2")
+	assert.Equal(t, 6, calls("GetRepoIssueLabels"))
+
+	assert.Equal(t, http.StatusBadRequest, post("X-GitHub-Event", "label", "{"))
+
+	// the webhooks without the secret are rejected
+	signKey = []byte("forged")
+	assert.Equal(t, http.StatusUnauthorized, post("X-GitHub-Event", "label", `{"organization": {"login": "owner"}}`))
+	assert.Equal(t, http.StatusUnauthorized, post("X-Gitlab-Event", "Label Hook", `{"organization": {"login": "owner"}}`))
+	w := httptest.NewRecorder()
+	cache.handler(secret).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/cache-events", strings.NewReader("{}")))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Nil(t, newReadCache(0, m))
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	secret, payload := []byte("secret"), []byte("{}")
+	req := func(headers ...string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/cache-events", nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.Header.Set(headers[i], headers[i+1])
+		}
+		return r
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	assert.True(t, verifyWebhook(req(headerGitCodeSignature, "sha256="+hex.EncodeToString(mac.Sum(nil))), payload, secret))
+	assert.False(t, verifyWebhook(req(headerGitCodeSignature, "sha256="+hex.EncodeToString(mac.Sum(nil))), []byte("[]"), secret))
+
+	// Gitee sends the password, or signs the timestamp
+	assert.True(t, verifyWebhook(req(headerGiteeToken, "secret"), payload, secret))
+	mac = hmac.New(sha256.New, secret)
+	mac.Write([]byte("1700000000000\nsecret"))
+	sign := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	assert.True(t, verifyWebhook(req(headerGiteeToken, sign, headerGiteeTimestamp, "1700000000000"), payload, secret))
+	assert.False(t, verifyWebhook(req(headerGiteeToken, sign, headerGiteeTimestamp, "1700000000001"), payload, secret))
+
+	assert.False(t, verifyWebhook(req(), payload, secret))
+}
+
+func TestCacheEventTypes(t *testing.T) {
+	secret := []byte("secret")
+	testCases := []struct {
+		header, eventType, payload    string
+		dropsLabels, dropsPermissions bool
+	}{
+		{"X-GitHub-Event", "label", `{"repository": {"full_name": "owner/repo1"}}`, true, false},
+		{"X-GitHub-Event", "member", `{"repository": {"full_name": "owner/repo1"}}`, false, true},
+		{"X-GitHub-Event", "membership", `{"organization": {"login": "owner"}}`, false, true},
+		{"X-GitHub-Event", "organization", `{"organization": {"login": "owner"}}`, false, true},
+		{"X-GitHub-Event", "team", `{"organization": {"login": "owner"}}`, false, true},
+		{"X-GitHub-Event", "team_add", `{"repository": {"full_name": "owner/repo1"}}`, false, true},
+		{"X-GitHub-Event", "pull_request", `{"repository": {"full_name": "owner/repo1"}}`, false, false},
+		{"X-GitHub-Event", "labels_renamed", `{"repository": {"full_name": "owner/repo1"}}`, false, false},
+		{headerEventType, "Label Hook", `{"project": {"path_with_namespace": "owner/repo1"}}`, true, false},
+		{headerEventType, "Member Hook", `{"project": {"path_with_namespace": "owner/repo1"}}`, false, true},
+		{"X-Gitlab-Event", "Member Hook", `{"group_path": "owner"}`, false, true},
+		{"X-Gitee-Event", "Note Hook", `{"repository": {"full_name": "owner/repo1"}}`, false, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.header+" "+tc.eventType, func(t *testing.T) {
+			cache := newReadCache(time.Minute, newRobotMetrics())
+			store(cache, cache.repoLabels, "owner/repo1", []string{"kind/bug"})
+			store(cache, cache.permissions, "owner/repo1/alice", true)
+
+			req := httptest.NewRequest(http.MethodPost, "/cache-events", strings.NewReader(tc.payload))
+			req.Header.Set(tc.header, tc.eventType)
+			mac := hmac.New(sha256.New, secret)
+			mac.Write([]byte(tc.payload))
+			req.Header.Set(headerGitHubSignature, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+			w := httptest.NewRecorder()
+			cache.handler(secret).ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			_, ok := cache.repoLabels["owner/repo1"]
+			assert.Equal(t, tc.dropsLabels, !ok)
+			_, ok = cache.permissions["owner/repo1/alice"]
+			assert.Equal(t, tc.dropsPermissions, !ok)
+		})
+	}
+}
+
+func TestCacheSweep(t *testing.T) {
+	cache := newReadCache(time.Minute, newRobotMetrics())
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	for _, user := range []string{"alice", "bob", "carol"} {
+		store(cache, cache.permissions, "owner/repo1/"+user, true)
+	}
+	store(cache, cache.repoLabels, "owner/repo1", []string{"kind/bug"})
+
+	// the entries which are not looked up again are swept when the others are stored later
+	now = now.Add(30 * time.Second)
+	store(cache, cache.permissions, "owner/repo1/dave", true)
+	assert.Equal(t, 4, len(cache.permissions))
+	now = now.Add(time.Minute)
+	store(cache, cache.permissions, "owner/repo2/alice", true)
+	_, ok := cache.permissions["owner/repo2/alice"]
+	assert.True(t, ok)
+	assert.Equal(t, 1, len(cache.permissions))
+	assert.Empty(t, cache.repoLabels)
+}
@@ -0,0 +1,207 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/opensourceways/robot-framework-lib/client"
+	"github.com/opensourceways/robot-framework-lib/utils"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// regexpHunkHeader matches the hunk headers, the line ranges and the section headings in them shift when the PR is rebased
+var regexpHunkHeader = regexp.MustCompile(`(?m)^@@ .*$`)
+
+// the default bounds of prChanges
+const (
+	defaultPRChangesSize = 10000
+	defaultPRChangesTTL  = 30 * 24 * time.Hour
+)
+
+// prChanges remembers the fingerprints of the files changed by each open PR, so that
+// what a push changes can be told by comparing with the fingerprints before the push.
+// They are kept in the memory of the process, so the first push after the bot restarts is regarded
+// as changing every file of the PR, and the replicas of the bot do not share them. It is bounded by
+// size, the least recently pushed PRs are forgotten first, and the fingerprints expire after ttl.
+type prChanges struct {
+	lock  sync.Mutex
+	size  int
+	ttl   time.Duration
+	now   func() time.Time
+	order *list.List
+	items map[string]*list.Element
+}
+
+// prChangesItem is the element of the order of prChanges
+type prChangesItem struct {
+	key          string
+	fingerprints map[string]string
+	at           time.Time
+}
+
+func newPRChanges() *prChanges {
+	return newBoundedPRChanges(defaultPRChangesSize, defaultPRChangesTTL)
+}
+
+// newBoundedPRChanges returns a prChanges which remembers size PRs at most for ttl, 0 means unbounded
+func newBoundedPRChanges(size int, ttl time.Duration) *prChanges {
+	return &prChanges{size: size, ttl: ttl, now: time.Now, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// swap records the fingerprints of the PR, and returns the previous ones, ok is false if they are unknown.
+// A nil prChanges remembers nothing.
+func (p *prChanges) swap(key string, fingerprints map[string]string) (prev map[string]string, ok bool) {
+	if p == nil {
+		return nil, false
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := p.now()
+	if e, exist := p.items[key]; exist {
+		item := e.Value.(*prChangesItem)
+		prev, ok = item.fingerprints, p.ttl == 0 || now.Sub(item.at) < p.ttl
+		item.fingerprints, item.at = fingerprints, now
+		p.order.MoveToFront(e)
+	} else {
+		p.items[key] = p.order.PushFront(&prChangesItem{key: key, fingerprints: fingerprints, at: now})
+	}
+	if !ok {
+		prev = nil
+	}
+
+	// the least recently pushed ones are evicted, as well as the expired ones behind them
+	for e := p.order.Back(); e != nil; e = p.order.Back() {
+		item := e.Value.(*prChangesItem)
+		if (p.size == 0 || p.order.Len() <= p.size) && (p.ttl == 0 || now.Sub(item.at) < p.ttl) {
+			break
+		}
+		p.order.Remove(e)
+		delete(p.items, item.key)
+	}
+
+	return
+}
+
+func (p *prChanges) forget(key string) {
+	if p == nil {
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if e, ok := p.items[key]; ok {
+		p.order.Remove(e)
+		delete(p.items, key)
+	}
+}
+
+// fingerprintChanges returns the fingerprints of the patches keyed by the file names
+func fingerprintChanges(files []client.CommitFile) map[string]string {
+	fingerprints := make(map[string]string, len(files))
+	for i := range files {
+		h := sha256.New()
+		h.Write([]byte(utils.GetString(files[i].Status)))
+		if patch := files[i].Patch; patch != nil && (patch.TooLarge == nil || !*patch.TooLarge) {
+			h.Write([]byte(regexpHunkHeader.ReplaceAllString(utils.GetString(patch.Diff), "@@")))
+		} else {
+			// the patch is unavailable, the file is regarded as changed if its content changed
+			h.Write([]byte(utils.GetString(files[i].SHA)))
+		}
+		fingerprints[utils.GetString(files[i].Filename)] = hex.EncodeToString(h.Sum(nil))
+	}
+
+	return fingerprints
+}
+
+// pushedChanges describes what a push changed in a PR
+type pushedChanges struct {
+	// known is false if the changes before the push are unknown
+	known bool
+	// files are the files changed by the push, or all the files of the PR if the changes before the push are unknown
+	files []string
+}
+
+// rebased returns true if the push leaves the changes of the PR as they were, e.g. a pure rebase
+func (c *pushedChanges) rebased() bool {
+	return c.known && len(c.files) == 0
+}
+
+// touches returns true if the push changed any file matching the patterns
+func (c *pushedChanges) touches(patterns []*regexp.Regexp) bool {
+	return slices.ContainsFunc(c.files, func(f string) bool {
+		return matchAnyPattern(f, patterns)
+	})
+}
+
+func prKey(org, repo, number string) string {
+	return strings.Join([]string{org, repo, number}, "/")
+}
+
+// recordPRChanges fetches the changes of the PR and compares them with the ones before the push,
+// it returns nil if the repository has no conditions on the changes, or the changes can not be fetched.
+func (bot *robot) recordPRChanges(org, repo, number string, repoCnf *repoConfig) *pushedChanges {
+	if !repoCnf.hasClearLabelsConditions() {
+		return nil
+	}
+
+	key := prKey(org, repo, number)
+	files, success := bot.cli.GetPullRequestChanges(org, repo, number)
+	if !success {
+		// the next push can not be compared with the stale fingerprints
+		bot.changes.forget(key)
+		return nil
+	}
+
+	fingerprints := fingerprintChanges(files)
+	prev, ok := bot.changes.swap(key, fingerprints)
+	changes := &pushedChanges{known: ok}
+	for f, fp := range fingerprints {
+		if !ok || prev[f] != fp {
+			changes.files = append(changes.files, f)
+		}
+	}
+	for f := range prev {
+		if _, exist := fingerprints[f]; !exist {
+			changes.files = append(changes.files, f)
+		}
+	}
+	slices.Sort(changes.files)
+
+	return changes
+}
+
+// filterClearLabels keeps the labels which should be cleared by the push according to the conditions of the repository
+func (c *repoConfig) filterClearLabels(labels []string, changes *pushedChanges) []string {
+	if changes == nil {
+		return labels
+	}
+
+	if c.SkipClearingOnRebase && changes.rebased() {
+		return nil
+	}
+
+	return slices.DeleteFunc(labels, func(l string) bool {
+		patterns, ok := c.clearLabelsPathPatterns[l]
+		return ok && !changes.touches(patterns)
+	})
+}
@@ -0,0 +1,111 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"github.com/opensourceways/robot-framework-lib/client"
+	"github.com/opensourceways/robot-framework-lib/framework"
+	"github.com/opensourceways/server-common-lib/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func commitFile(name, diff string) client.CommitFile {
+	status := "modified"
+	return client.CommitFile{Filename: &name, Status: &status, Patch: &client.CommitPatch{Diff: &diff}}
+}
+
+func TestFingerprintChanges(t *testing.T) {
+	before := fingerprintChanges([]client.CommitFile{commitFile("a.go", "@@ -1,2 +1,3 @@\n a\n+b\n")})
+	// the hunk moves after a rebase
+	rebased := fingerprintChanges([]client.CommitFile{commitFile("a.go", "@@ -11,2 +11,3 @@ func a() {\n a\n+b\n")})
+	changed := fingerprintChanges([]client.CommitFile{commitFile("a.go", "@@ -1,2 +1,3 @@\n a\n+c\n")})
+
+	assert.Equal(t, before, rebased)
+	assert.NotEqual(t, before["a.go"], changed["a.go"])
+}
+
+func TestPRChangesBounds(t *testing.T) {
+	now := time.Unix(0, 0)
+	p := newBoundedPRChanges(2, time.Hour)
+	p.now = func() time.Time { return now }
+	a, b := map[string]string{"a.go": "1"}, map[string]string{"b.go": "2"}
+
+	_, ok := p.swap("pr1", a)
+	assert.Equal(t, false, ok)
+	_, _ = p.swap("pr2", b)
+	prev, ok := p.swap("pr1", b)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, a, prev)
+
+	// pr2 is the least recently pushed one
+	_, _ = p.swap("pr3", a)
+	assert.Equal(t, 2, p.order.Len())
+	_, ok = p.swap("pr2", a)
+	assert.Equal(t, false, ok)
+
+	now = now.Add(time.Hour)
+	prev, ok = p.swap("pr2", b)
+	assert.Equal(t, false, ok)
+	assert.Nil(t, prev)
+	// the expired ones are evicted
+	assert.Equal(t, 1, len(p.items))
+}
+
+func TestClearLabelsConditionally(t *testing.T) {
+	cli := &mockClient{
+		successfulCheckIfPRSourceCodeUpdateEvent: true,
+		successfulGetPullRequestLabels:           true,
+		successfulGetPullRequestChanges:          true,
+		successfulRemovePRLabels:                 true,
+		labels:                                   []string{"lgtm"},
+	}
+	bot := &robot{cli: cli, changes: newPRChanges(), log: framework.NewLogger(), cnf: &configuration{CommentTemplates: CommentTemplates{
+		CommentRemoveLabelsWhenPRSourceCodeUpdated: "removes {{join .Labels \", \"}}",
+	}}}
+
+	cnf := &repoConfig{
+		RepoFilter:           config.RepoFilter{Repos: []string{org}},
+		ClearLabels:          []string{"lgtm"},
+		SkipClearingOnRebase: true,
+		ClearLabelsPaths:     map[string][]string{"lgtm": {"src/*"}},
+	}
+	assert.Nil(t, cnf.validateRepoConfig())
+
+	src, docs := commitFile("src/a.go", "@@ -1 +1 @@\n-a\n+b\n"), commitFile("docs/a.md", "@@ -1 +1 @@\n-a\n+b\n")
+	push := func(files ...client.CommitFile) string {
+		cli.changes = files
+		cli.comment = ""
+		bot.clearLabelWhenPRSourceCodeUpdated(org, repo, number, cnf, &client.GenericEvent{})
+		return cli.comment
+	}
+
+	// the changes before the first push are unknown, the PR changes src
+	assert.Equal(t, "removes lgtm", push(src))
+	// a pure rebase
+	assert.Equal(t, "", push(src))
+	// a docs only follow-up
+	assert.Equal(t, "", push(src, docs))
+	// src is changed again
+	assert.Equal(t, "removes lgtm", push(commitFile("src/a.go", "@@ -1 +1 @@\n-a\n+c\n"), docs))
+	// reverting the change of docs is also a change, but not under src
+	assert.Equal(t, "", push(commitFile("src/a.go", "@@ -1 +1 @@\n-a\n+c\n")))
+
+	// the changes can not be fetched, the labels are cleared as usual
+	cli.successfulGetPullRequestChanges = false
+	assert.Equal(t, "removes lgtm", push(src))
+	cli.successfulGetPullRequestChanges = true
+	assert.Equal(t, "removes lgtm", push(src))
+}
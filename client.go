@@ -0,0 +1,175 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/opensourceways/go-gitcode/openapi"
+	"github.com/opensourceways/robot-framework-lib/client"
+	"github.com/opensourceways/robot-framework-lib/utils"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const gitcodeBaseURL = "https://api.gitcode.com/api/v5/"
+
+// requestAttempts is the number of the attempts of a request of the API client, the reactions are retried in the same way
+const requestAttempts = 3
+
+// gitcodeClient supplements the framework client with the GitCode APIs
+// which the bot needs but the framework does not provide.
+type gitcodeClient struct {
+	client.Client
+	api     *openapi.APIClient
+	baseURL string
+	logger  *logrus.Entry
+	// retryDelay is the delay before the second attempt of a request, it grows with the attempts
+	retryDelay time.Duration
+	// limit charges the requests which the client makes itself, the calls of the framework client are charged
+	// by the rateLimitedClient which wraps it
+	limit *requestLimit
+
+	lock sync.Mutex
+	// login is the login name of the user of the token, it is empty until it is fetched
+	login string
+}
+
+func newClient(token []byte, logger *logrus.Entry) *gitcodeClient {
+	return &gitcodeClient{
+		Client:     client.NewClient(token, logger),
+		api:        openapi.NewAPIClientWithAuthorization(token),
+		baseURL:    gitcodeBaseURL,
+		logger:     logger,
+		retryDelay: time.Second,
+	}
+}
+
+// validate returns an error if the framework client is not created
+func (c *gitcodeClient) validate() error {
+	if c.Client == nil {
+		return errors.New("failed to create the GitCode client, the token is rejected or the API is unreachable")
+	}
+
+	return nil
+}
+
+// GetIssueLabels gets the labels of the issue by the id, the issues of GitCode are addressed by the id in the org
+func (c *gitcodeClient) GetIssueLabels(org, repo, number, issueID string) ([]string, bool) {
+	return c.Client.GetIssueLabels(org, issueID)
+}
+
+// CreatePRCommentReaction reacts to a comment of a pull request with the emoji of reaction
+func (c *gitcodeClient) CreatePRCommentReaction(org, repo, commentID, reaction string) (success bool) {
+	return c.createReaction(fmt.Sprintf("repos/%s/%s/pulls/comments/%s/reactions", org, repo, commentID), reaction)
+}
+
+// CreateIssueCommentReaction reacts to a comment of an issue with the emoji of reaction
+func (c *gitcodeClient) CreateIssueCommentReaction(org, repo, commentID, reaction string) (success bool) {
+	return c.createReaction(fmt.Sprintf("repos/%s/%s/issues/comments/%s/reactions", org, repo, commentID), reaction)
+}
+
+// createReaction retries in the same way as the API client, but builds the request again for each attempt,
+// since the body of the request is consumed by the previous one.
+func (c *gitcodeClient) createReaction(path, reaction string) bool {
+	body, _ := json.Marshal(map[string]string{"content": reaction})
+	for i := 1; ; i++ {
+		req, err := http.NewRequest(http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+		if err != nil {
+			c.logger.WithError(err).Error("failed to build the reaction request")
+			return false
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		c.limit.wait(priorityMutation)
+		resp, err := c.api.BareDo(context.Background(), req)
+		if err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode <= http.StatusUnavailableForLegalReasons {
+				return resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated
+			}
+			err = errors.New(resp.Status)
+		}
+		if i == requestAttempts {
+			c.logger.WithError(err).Errorf("failed to create the reaction: %s", path)
+			return false
+		}
+		time.Sleep(time.Duration(i) * c.retryDelay)
+	}
+}
+
+// UpdatePRComment edits a comment of a pull request
+func (c *gitcodeClient) UpdatePRComment(org, repo, commentID, comment string) (success bool) {
+	c.limit.wait(priorityMutation)
+	success, err := c.api.PullRequests.UpdatePullRequestComment(context.Background(), org, repo, commentID, comment)
+	if err != nil {
+		c.logger.WithError(err).Errorf("failed to update the comment %s of %s/%s", commentID, org, repo)
+		c.limit.charge(requestAttempts - 1)
+		success = false
+	}
+	return
+}
+
+// ListBotPRComments lists the comments of the pull request created by the user of the token
+func (c *gitcodeClient) ListBotPRComments(org, repo, number string) ([]client.PRComment, bool) {
+	login, ok := c.user()
+	if !ok {
+		return nil, false
+	}
+
+	var r []client.PRComment
+	for page := 1; ; page++ {
+		c.limit.wait(priorityRead)
+		comments, ok, err := c.api.PullRequests.ListPullRequestComments(
+			context.Background(), org, repo, number, strconv.Itoa(page), "pr_comment")
+		if err != nil || !ok {
+			c.logger.WithError(err).Errorf("failed to list the comments of %s/%s/%s", org, repo, number)
+			c.limit.charge(requestAttempts - 1)
+			return nil, false
+		}
+		if len(comments) == 0 {
+			return r, true
+		}
+		for _, cm := range comments {
+			if cm.User != nil && utils.GetString(cm.User.Login) == login {
+				r = append(r, client.PRComment{ID: cm.ID.String(), Body: utils.GetString(cm.Body)})
+			}
+		}
+	}
+}
+
+// user returns the login name of the user of the token, it is fetched once
+func (c *gitcodeClient) user() (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.login == "" {
+		c.limit.wait(priorityRead)
+		u, ok, err := c.api.User.GetUserInfo(context.Background())
+		if err != nil || !ok || u == nil || utils.GetString(u.Login) == "" {
+			c.logger.WithError(err).Error("failed to get the user of the token")
+			c.limit.charge(requestAttempts - 1)
+			return "", false
+		}
+		c.login = *u.Login
+	}
+
+	return c.login, true
+}
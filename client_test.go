@@ -0,0 +1,69 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"encoding/json"
+	"github.com/opensourceways/go-gitcode/openapi"
+	"github.com/opensourceways/robot-framework-lib/framework"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCreateCommentReaction(t *testing.T) {
+	var gotPath, gotReaction, gotAuth string
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.Path, r.Header.Get("Authorization")
+		body := map[string]string{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		gotReaction = body["content"]
+		// the first attempt fails, the retry sends the body again
+		if r.URL.Path == "/repos/org1/repo1/issues/comments/502/reactions" && attempts == 0 {
+			attempts++
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if r.URL.Path == "/repos/org1/repo1/issues/comments/404/reactions" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	cli := &gitcodeClient{
+		api:     openapi.NewAPIClientWithAuthorization([]byte("token1")),
+		baseURL: server.URL + "/",
+		logger:  framework.NewLogger(),
+	}
+
+	assert.Equal(t, true, cli.CreatePRCommentReaction(org, repo, "12", reactionSuccess))
+	assert.Equal(t, "/repos/org1/repo1/pulls/comments/12/reactions", gotPath)
+	assert.Equal(t, reactionSuccess, gotReaction)
+	assert.Equal(t, "Bearer token1", gotAuth)
+
+	assert.Equal(t, true, cli.CreateIssueCommentReaction(org, repo, "13", reactionFailure))
+	assert.Equal(t, "/repos/org1/repo1/issues/comments/13/reactions", gotPath)
+	assert.Equal(t, reactionFailure, gotReaction)
+
+	assert.Equal(t, false, cli.CreateIssueCommentReaction(org, repo, "404", reactionFailure))
+
+	gotReaction = ""
+	assert.Equal(t, true, cli.CreateIssueCommentReaction(org, repo, "502", reactionSuccess))
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, reactionSuccess, gotReaction)
+}
@@ -0,0 +1,428 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// the names of the comment templates, they are the same as the json keys of the configuration
+const (
+	templateUserMarkFormat                             = "user_mark_format"
+	templateCommentCommandTrigger                      = "comment_command_trigger"
+	templateCommentRemoveLabelsWhenPRSourceCodeUpdated = "comment_remove_labels_when_pr_source_code_updated"
+	templateCommentLabelCommandConflict                = "comment_label_command_conflict"
+	templateCommentUpdateLabelFailed                   = "comment_update_label_failed"
+	templateCommentAddNotExistLabel                    = "comment_add_not_exist_label"
+	templateCommentCommandReport                       = "comment_command_report"
+	templateCommentKeepLabelsForTrustedPusher          = "comment_keep_labels_for_trusted_pusher"
+
+	// defaultCommentKeepLabelsForTrustedPusher notes that the labels are kept for the push of a trusted pusher
+	defaultCommentKeepLabelsForTrustedPusher = "### Notification  \n\nThis pull request source branch is updated by " +
+		"{{.Commenter}} who is trusted, so keeps the following label(s): {{join .Labels \", \"}}."
+
+	// templateKindComment is the kind of templates which are rendered with commentData
+	templateKindComment = "comment"
+	// templateKindReport is the kind of templates which are rendered with commandReport
+	templateKindReport = "report"
+
+	// defaultLocale is the name of the locale which the global comment templates belong to
+	defaultLocale = "default"
+	// localeSeparator separates the renderings of the locales in a combined comment
+	localeSeparator = "\n\n---\n\n"
+)
+
+// CommentTemplates holds the templates of the comments posted by the bot in a language.
+// The fields tagged with template are text/template templates, see commentData for the data model of them.
+type CommentTemplates struct {
+	UserMarkFormat                             string `json:"user_mark_format" required:"true" template:"comment"`
+	CommentCommandTrigger                      string `json:"comment_command_trigger" required:"true" template:"comment"`
+	CommentRemoveLabelsWhenPRSourceCodeUpdated string `json:"comment_remove_labels_when_pr_source_code_updated" required:"true" template:"comment"`
+	CommentLabelCommandConflict                string `json:"comment_label_command_conflict" required:"true" template:"comment"`
+	CommentUpdateLabelFailed                   string `json:"comment_update_label_failed" required:"true" template:"comment"`
+	CommentAddNotExistLabel                    string `json:"comment_add_not_exist_label" required:"true" template:"comment"`
+	// CommentCommandReport consolidates all feedback of a label command comment, see commandReport for the data model of it.
+	// default: the feedback messages separated by horizontal rules
+	CommentCommandReport string `json:"comment_command_report,omitempty" template:"report"`
+	// CommentKeepLabelsForTrustedPusher notes that the labels are kept because the source branch is updated
+	// by a trusted pusher, {{.Commenter}} is the mention of the pusher. default: defaultCommentKeepLabelsForTrustedPusher
+	CommentKeepLabelsForTrustedPusher string `json:"comment_keep_labels_for_trusted_pusher,omitempty" template:"comment"`
+	// PlaceholderCommenter is deprecated, it is replaced by {{.Commenter}} in user_mark_format
+	PlaceholderCommenter string `json:"placeholder_commenter,omitempty"`
+}
+
+// legacyVerbs are the data which the %s verbs of the legacy fmt formats refer to in order, keyed by the template name.
+// The templates were fmt formats before, the legacy ones are converted with a deprecation warning.
+var legacyVerbs = map[string][]string{
+	templateCommentRemoveLabelsWhenPRSourceCodeUpdated: {`{{join .Labels ", "}}`},
+	templateCommentLabelCommandConflict:                {"{{.Commenter}}", `{{join .Labels "**, **"}}`},
+	templateCommentUpdateLabelFailed:                   {"{{.Commenter}}", `{{join .Labels ", "}}`},
+	templateCommentAddNotExistLabel:                    {"{{.Commenter}}", `{{join .Labels ", "}}`},
+}
+
+// convertLegacy converts placeholder_commenter and the legacy fmt formats to the templates,
+// it returns the deprecation warnings located at the converted fields.
+// The formats which have more verbs than the legacy ones are left to be rejected by newCommentTemplate.
+func (ct *CommentTemplates) convertLegacy() []error {
+	var warnings []error
+	if ct.PlaceholderCommenter != "" && strings.Contains(ct.UserMarkFormat, ct.PlaceholderCommenter) {
+		ct.UserMarkFormat = strings.ReplaceAll(ct.UserMarkFormat, ct.PlaceholderCommenter, "{{.Commenter}}")
+		warnings = append(warnings, locate("placeholder_commenter",
+			errors.New("deprecated, user_mark_format is converted to "+ct.UserMarkFormat)))
+	}
+
+	k := reflect.TypeOf(*ct)
+	v := reflect.ValueOf(ct).Elem()
+	n := k.NumField()
+	for i := 0; i < n; i++ {
+		name := strings.Split(k.Field(i).Tag.Get("json"), ",")[0]
+		verbs, ok := legacyVerbs[name]
+		parts := strings.Split(v.Field(i).String(), "%s")
+		if !ok || len(parts) == 1 || len(parts)-1 > len(verbs) {
+			continue
+		}
+
+		var b strings.Builder
+		for j, part := range parts {
+			if j > 0 {
+				b.WriteString(verbs[j-1])
+			}
+			b.WriteString(strings.ReplaceAll(part, "%%", "%"))
+		}
+		v.Field(i).SetString(b.String())
+		warnings = append(warnings, locate(name, errors.New("the fmt verb %s is deprecated, converted to "+b.String())))
+	}
+
+	return warnings
+}
+
+// defaultTemplates are used for the optional templates which are not set
+var defaultTemplates = map[string]string{
+	templateCommentCommandReport:              defaultCommentCommandReport,
+	templateCommentKeepLabelsForTrustedPusher: defaultCommentKeepLabelsForTrustedPusher,
+}
+
+// commentData is the data model of the comment templates.
+//
+//	{{.Commenter}} the mention of the commenter, or the pusher for the comments about a push,
+//	               it is rendered by user_mark_format. In user_mark_format itself, it is the login name
+//	{{.Labels}}    the labels which the comment is about, e.g. {{join .Labels ", "}}
+//	{{.Org}}       the organization of the repository
+//	{{.Repo}}      the name of the repository
+//	{{.Number}}    the number of the pull request or issue
+//	{{.Link}}      the html url of the pull request or issue, it is empty if unknown
+type commentData struct {
+	Commenter string
+	Labels    []string
+	Org       string
+	Repo      string
+	Number    string
+	Link      string
+}
+
+// commentTemplateFuncs are the functions which can be used in the comment templates.
+var commentTemplateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// sampleCommentData is used to execute the templates once when validating them,
+// so that a template refers to the unknown field fails at startup.
+var sampleCommentData = commentData{
+	Commenter: "commenter",
+	Labels:    []string{"kind/bug", "sig/doc"},
+	Org:       "org",
+	Repo:      "repo",
+	Number:    "1",
+	Link:      "https://gitcode.com/org/repo/pulls/1",
+}
+
+func newCommentTemplate(name, kind, text string) (*template.Template, error) {
+	if text == "" {
+		text = defaultTemplates[name]
+	}
+
+	// the templates were fmt formats before, a leftover verb would be posted as it is
+	if strings.Contains(text, "%s") {
+		return nil, errors.New("the fmt verb %s is not supported, refer to the data by the fields instead, e.g. {{.Commenter}}")
+	}
+
+	t, err := template.New(name).Funcs(commentTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var sample any = &sampleCommentData
+	if kind == templateKindReport {
+		sample = &commandReport{commentData: sampleCommentData, Sections: []string{"section"}}
+	}
+	if err = t.Execute(io.Discard, sample); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// parse parses all the fields tagged with template, returns the errors located at the broken ones.
+// If onlySet is true, the empty fields are skipped, it is used to parse the overrides of a repository.
+func (ct *CommentTemplates) parse(onlySet bool) (map[string]*template.Template, []error) {
+	k := reflect.TypeOf(*ct)
+	v := reflect.ValueOf(*ct)
+
+	templates := make(map[string]*template.Template)
+	var errs []error
+	n := k.NumField()
+	for i := 0; i < n; i++ {
+		kind := k.Field(i).Tag.Get("template")
+		if kind == "" || (onlySet && v.Field(i).String() == "") {
+			continue
+		}
+
+		name := strings.Split(k.Field(i).Tag.Get("json"), ",")[0]
+		t, err := newCommentTemplate(name, kind, v.Field(i).String())
+		if err != nil {
+			errs = append(errs, locate(name, errors.New("invalid template: "+err.Error())))
+			continue
+		}
+		templates[name] = t
+	}
+
+	return templates, errs
+}
+
+// parseTemplates parses the global comment templates and the ones of each locale,
+// and checks that every locale defines every required template.
+func (c *configuration) parseTemplates() error {
+	if _, ok := c.Locales[defaultLocale]; ok {
+		return locate("locales."+defaultLocale, errors.New("the locale is reserved for the global comment templates"))
+	}
+
+	templates := make(map[string]map[string]*template.Template, len(c.Locales)+1)
+	t, errs := c.CommentTemplates.parse(false)
+	templates[defaultLocale] = t
+
+	for _, locale := range sortedKeys(c.Locales) {
+		ct := c.Locales[locale]
+		path := "locales." + locale
+		if missing := missingRequired(&ct); len(missing) != 0 {
+			errs = append(errs, locate(path, errors.New("missing the follow templates: "+strings.Join(missing, ", "))))
+			continue
+		}
+
+		t, localeErrs := ct.parse(false)
+		if len(localeErrs) != 0 {
+			for _, err := range localeErrs {
+				errs = append(errs, locate(path, err))
+			}
+			continue
+		}
+		templates[locale] = t
+	}
+
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+	c.templates = templates
+
+	return nil
+}
+
+// convertLegacyTemplates converts the legacy comment templates of the configuration,
+// including the ones of the locales and the config items, and returns the deprecation warnings.
+func (c *configuration) convertLegacyTemplates() []error {
+	warnings := c.CommentTemplates.convertLegacy()
+	for _, locale := range sortedKeys(c.Locales) {
+		ct := c.Locales[locale]
+		for _, w := range ct.convertLegacy() {
+			warnings = append(warnings, locate("locales."+locale, w))
+		}
+		c.Locales[locale] = ct
+	}
+	for i := range c.ConfigItems {
+		path := fmt.Sprintf("config_items[%d]", i)
+		for _, w := range c.ConfigItems[i].CommentTemplates.convertLegacy() {
+			warnings = append(warnings, locate(path, w))
+		}
+		for _, locale := range sortedKeys(c.ConfigItems[i].LocaleTemplates) {
+			ct := c.ConfigItems[i].LocaleTemplates[locale]
+			for _, w := range ct.convertLegacy() {
+				warnings = append(warnings, locate(path+".locale_templates."+locale, w))
+			}
+			c.ConfigItems[i].LocaleTemplates[locale] = ct
+		}
+	}
+
+	return warnings
+}
+
+// localesOf returns the locales which the comments of the repository are rendered in
+func localesOf(repoCnf *repoConfig) []string {
+	if repoCnf == nil || len(repoCnf.Locales) == 0 {
+		return []string{defaultLocale}
+	}
+
+	return repoCnf.Locales
+}
+
+// parseTemplates parses the comment templates which override the global ones for the repository,
+// only the locales which have overrides are kept.
+func (c *repoConfig) parseTemplates() error {
+	if _, ok := c.LocaleTemplates[defaultLocale]; ok {
+		return locate("locale_templates."+defaultLocale,
+			errors.New("the locale is reserved, the templates of it are set on the item itself"))
+	}
+
+	templates := make(map[string]map[string]*template.Template, len(c.LocaleTemplates)+1)
+	t, errs := c.CommentTemplates.parse(true)
+	if len(t) != 0 {
+		templates[defaultLocale] = t
+	}
+	for _, locale := range sortedKeys(c.LocaleTemplates) {
+		ct := c.LocaleTemplates[locale]
+		t, localeErrs := ct.parse(true)
+		for _, err := range localeErrs {
+			errs = append(errs, locate("locale_templates."+locale, err))
+		}
+		if len(t) != 0 {
+			templates[locale] = t
+		}
+	}
+
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+	c.templates = templates
+
+	return nil
+}
+
+// lookupTemplate returns the template of name in the locale,
+// the template overridden by the repository takes precedence over the global one.
+func (c *configuration) lookupTemplate(repoCnf *repoConfig, locale, name string) (*template.Template, error) {
+	if repoCnf != nil {
+		if repoCnf.templates == nil {
+			if err := repoCnf.parseTemplates(); err != nil {
+				return nil, err
+			}
+		}
+		if t, ok := repoCnf.templates[locale][name]; ok {
+			return t, nil
+		}
+	}
+
+	if c.templates == nil {
+		if err := c.parseTemplates(); err != nil {
+			return nil, err
+		}
+	}
+
+	t, ok := c.templates[locale][name]
+	if !ok {
+		return nil, errors.New("unknown template " + name + " of the locale " + locale)
+	}
+
+	return t, nil
+}
+
+func (c *configuration) execute(repoCnf *repoConfig, locale, name string, data any) (string, error) {
+	t, err := c.lookupTemplate(repoCnf, locale, name)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err = t.Execute(&b, data); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// render renders the comment template of name with data in the locales of the repository.
+// If the repository picks several locales, the renderings of them are combined into one comment.
+func (c *configuration) render(repoCnf *repoConfig, name string, data any) (string, error) {
+	locales := localesOf(repoCnf)
+	renderings := make([]string, 0, len(locales))
+	for _, locale := range locales {
+		s, err := c.execute(repoCnf, locale, name, data)
+		if err != nil {
+			return "", err
+		}
+		renderings = append(renderings, s)
+	}
+
+	return strings.Join(renderings, localeSeparator), nil
+}
+
+// renderReport renders the report of a label command in the locales of the repository.
+// The feedback messages of the report are rendered in the same locale as the report.
+func (c *configuration) renderReport(repoCnf *repoConfig, report *commandReport) (string, error) {
+	locales := localesOf(repoCnf)
+	renderings := make([]string, 0, len(locales))
+	for _, locale := range locales {
+		r := *report
+		r.Sections = make([]string, 0, len(report.failures))
+		for _, f := range report.failures {
+			s, err := c.execute(repoCnf, locale, f.name, f.data)
+			if err != nil {
+				return "", err
+			}
+			r.Sections = append(r.Sections, s)
+		}
+
+		s, err := c.execute(repoCnf, locale, templateCommentCommandReport, &r)
+		if err != nil {
+			return "", err
+		}
+		renderings = append(renderings, s)
+	}
+
+	return strings.Join(renderings, localeSeparator), nil
+}
+
+// comment renders the comment template of name with data, and logs the error if failed
+func (bot *robot) comment(repoCnf *repoConfig, name string, data any) string {
+	s, err := bot.cnf.render(repoCnf, name, data)
+	if err != nil {
+		bot.log.WithError(err).Errorf("failed to render the template %s", name)
+	}
+
+	return s
+}
+
+// newCommentData builds the data for rendering the comment templates,
+// the commenter is converted to the mention of it by user_mark_format of the first locale of the repository.
+func (bot *robot) newCommentData(repoCnf *repoConfig, org, repo, number, commenter, link string) commentData {
+	data := commentData{Org: org, Repo: repo, Number: number, Link: link}
+	if commenter != "" {
+		data.Commenter = commenter
+		mention, err := bot.cnf.execute(repoCnf, localesOf(repoCnf)[0], templateUserMarkFormat, &data)
+		if err != nil {
+			bot.log.WithError(err).Errorf("failed to render the template %s", templateUserMarkFormat)
+		}
+		data.Commenter = mention
+	}
+
+	return data
+}
+
+// withLabels returns a copy of the data which is about the labels
+func (d commentData) withLabels(labels []string) *commentData {
+	d.Labels = labels
+	return &d
+}
@@ -0,0 +1,206 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"github.com/opensourceways/robot-framework-lib/framework"
+	"github.com/opensourceways/server-common-lib/config"
+	"github.com/opensourceways/server-common-lib/utils"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseTemplates(t *testing.T) {
+	testCases := []struct {
+		desc string
+		in   *configuration
+		out  string
+	}{
+		{
+			"all templates are empty",
+			&configuration{},
+			"",
+		},
+		{
+			"a template is unable to parse",
+			&configuration{CommentTemplates: CommentTemplates{CommentUpdateLabelFailed: "{{.Commenter"}},
+			"comment_update_label_failed: invalid template: ",
+		},
+		{
+			"a template refers to the unknown field",
+			&configuration{CommentTemplates: CommentTemplates{CommentAddNotExistLabel: "{{.Label}}"}},
+			"can't evaluate field Label in type *main.commentData",
+		},
+		{
+			"a template refers to the field of report",
+			&configuration{CommentTemplates: CommentTemplates{CommentCommandTrigger: "{{.Sections}}"}},
+			"can't evaluate field Sections in type *main.commentData",
+		},
+		{
+			"a template calls the unknown function",
+			&configuration{CommentTemplates: CommentTemplates{CommentCommandReport: "{{split .Labels}}"}},
+			"function \"split\" not defined",
+		},
+	}
+	for i := range testCases {
+		t.Run(testCases[i].desc, func(t *testing.T) {
+			err := testCases[i].in.parseTemplates()
+			if testCases[i].out == "" {
+				assert.Nil(t, err)
+				assert.Equal(t, 8, len(testCases[i].in.templates[defaultLocale]))
+			} else {
+				assert.ErrorContains(t, err, testCases[i].out)
+			}
+		})
+	}
+}
+
+func TestParseLocales(t *testing.T) {
+	zh := CommentTemplates{
+		UserMarkFormat:                             "@{{.Commenter}}",
+		CommentCommandTrigger:                      "由于网络问题，请再次评论。",
+		CommentLabelCommandConflict:                "{{.Commenter}}，不能同时添加和删除标签 {{join .Labels \"，\"}}。",
+		CommentUpdateLabelFailed:                   "{{.Commenter}}，标签更新失败，请再次评论。",
+		CommentAddNotExistLabel:                    "{{.Commenter}}，仓库没有标签 {{join .Labels \"，\"}}，无法添加。",
+		CommentRemoveLabelsWhenPRSourceCodeUpdated: "源分支已更新，移除标签 {{join .Labels \"，\"}}。",
+	}
+
+	cnf := &configuration{Locales: map[string]CommentTemplates{"zh": zh}}
+	assert.Nil(t, cnf.parseTemplates())
+	assert.Equal(t, 8, len(cnf.templates["zh"]))
+
+	got, err := cnf.render(&repoConfig{Locales: []string{"zh"}}, templateCommentAddNotExistLabel,
+		&commentData{Commenter: "@a", Labels: []string{"kind/a", "kind/b"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "@a，仓库没有标签 kind/a，kind/b，无法添加。", got)
+
+	cnf.CommentCommandTrigger = "Because of the network problem, please comment once again."
+	assert.Nil(t, cnf.parseTemplates())
+	got, err = cnf.render(&repoConfig{Locales: []string{"zh", defaultLocale}}, templateCommentCommandTrigger, &commentData{})
+	assert.Nil(t, err)
+	assert.Equal(t, "由于网络问题，请再次评论。\n\n---\n\nBecause of the network problem, please comment once again.", got)
+
+	_, err = cnf.render(&repoConfig{Locales: []string{"en"}}, templateCommentCommandTrigger, &commentData{})
+	assert.EqualError(t, err, "unknown template comment_command_trigger of the locale en")
+
+	zh.CommentCommandTrigger = ""
+	zh.CommentAddNotExistLabel = "{{.Label}}"
+	cnf = &configuration{Locales: map[string]CommentTemplates{"zh": zh}}
+	assert.EqualError(t, cnf.parseTemplates(), "locales.zh: missing the follow templates: comment_command_trigger")
+
+	zh.CommentCommandTrigger = "由于网络问题，请再次评论。"
+	cnf = &configuration{Locales: map[string]CommentTemplates{"zh": zh}}
+	assert.ErrorContains(t, cnf.parseTemplates(), "locales.zh.comment_add_not_exist_label: invalid template: ")
+
+	cnf = &configuration{Locales: map[string]CommentTemplates{defaultLocale: zh}}
+	assert.EqualError(t, cnf.parseTemplates(), "locales.default: the locale is reserved for the global comment templates")
+}
+
+func TestRenderRepoOverrides(t *testing.T) {
+	cnf := &configuration{
+		CommentTemplates: CommentTemplates{
+			UserMarkFormat:           "@{{.Commenter}}",
+			CommentUpdateLabelFailed: "global {{.Commenter}}",
+		},
+		Locales: map[string]CommentTemplates{
+			"zh": {
+				UserMarkFormat:                             "@{{.Commenter}}",
+				CommentCommandTrigger:                      "c",
+				CommentLabelCommandConflict:                "d",
+				CommentUpdateLabelFailed:                   "zh {{.Commenter}}",
+				CommentAddNotExistLabel:                    "f",
+				CommentRemoveLabelsWhenPRSourceCodeUpdated: "g",
+			},
+		},
+	}
+	assert.Nil(t, cnf.parseTemplates())
+
+	repoCnf := &repoConfig{CommentTemplates: CommentTemplates{
+		UserMarkFormat:           "[{{.Commenter}}](https://gitcode.com/{{.Commenter}})",
+		CommentUpdateLabelFailed: "repo {{.Commenter}}",
+	}}
+	assert.Nil(t, repoCnf.parseTemplates())
+	assert.Equal(t, 2, len(repoCnf.templates[defaultLocale]))
+
+	bot := &robot{cnf: cnf, log: framework.NewLogger()}
+	data := bot.newCommentData(repoCnf, org, repo, number, commenter, "")
+	assert.Equal(t, "[commenter1](https://gitcode.com/commenter1)", data.Commenter)
+
+	// the overridden template of the repository
+	assert.Equal(t, "repo "+data.Commenter, bot.comment(repoCnf, templateCommentUpdateLabelFailed, &data))
+	// fall back to the global template
+	assert.Equal(t, "global "+data.Commenter, bot.comment(&repoConfig{}, templateCommentUpdateLabelFailed, &data))
+	// the overrides of the default locale do not apply to the other locales
+	repoCnf.Locales = []string{"zh", defaultLocale}
+	assert.Equal(t, "zh "+data.Commenter+localeSeparator+"repo "+data.Commenter,
+		bot.comment(repoCnf, templateCommentUpdateLabelFailed, &data))
+
+	// the overrides of the other locales
+	repoCnf.LocaleTemplates = map[string]CommentTemplates{"zh": {CommentUpdateLabelFailed: "仓库 {{.Commenter}}"}}
+	repoCnf.templates = nil
+	assert.Equal(t, "仓库 "+data.Commenter+localeSeparator+"repo "+data.Commenter,
+		bot.comment(repoCnf, templateCommentUpdateLabelFailed, &data))
+	repoCnf.Locales = []string{"zh"}
+	assert.Equal(t, "c", bot.comment(repoCnf, templateCommentCommandTrigger, &data))
+
+	repoCnf = &repoConfig{CommentTemplates: CommentTemplates{CommentAddNotExistLabel: "{{.Unknown}}"}}
+	assert.ErrorContains(t, repoCnf.parseTemplates(), "comment_add_not_exist_label: invalid template: ")
+	repoCnf = &repoConfig{LocaleTemplates: map[string]CommentTemplates{"zh": {CommentAddNotExistLabel: "{{.Unknown}}"}}}
+	assert.ErrorContains(t, repoCnf.parseTemplates(), "locale_templates.zh.comment_add_not_exist_label: invalid template: ")
+	repoCnf = &repoConfig{LocaleTemplates: map[string]CommentTemplates{defaultLocale: {}}}
+	assert.ErrorContains(t, repoCnf.parseTemplates(), "locale_templates.default: the locale is reserved")
+
+	// the overrides of the locales are layered
+	cnf.ConfigItems = []repoConfig{
+		{RepoFilter: config.RepoFilter{Repos: []string{"owner1"}}, Locales: []string{"zh"},
+			LocaleTemplates: map[string]CommentTemplates{"zh": {CommentUpdateLabelFailed: "组织 {{.Commenter}}"}}},
+		{RepoFilter: config.RepoFilter{Repos: []string{"owner1/repo1"}},
+			CommentTemplates: CommentTemplates{CommentUpdateLabelFailed: "repo {{.Commenter}}"}},
+	}
+	for i := range cnf.ConfigItems {
+		assert.Nil(t, cnf.ConfigItems[i].parseTemplates())
+	}
+	repoCnf = cnf.getRepoConfig("owner1", "repo1")
+	assert.Equal(t, "组织 "+data.Commenter, bot.comment(repoCnf, templateCommentUpdateLabelFailed, &data))
+	repoCnf.Locales = []string{defaultLocale}
+	assert.Equal(t, "repo "+data.Commenter, bot.comment(repoCnf, templateCommentUpdateLabelFailed, &data))
+	assert.Equal(t, 0, len(cnf.ConfigItems[0].templates[defaultLocale]))
+}
+
+func TestRender(t *testing.T) {
+	cnf := &configuration{}
+	err := utils.LoadFromYaml(findTestdata(t, configYaml), cnf)
+	assert.Nil(t, err)
+	assert.Nil(t, cnf.Validate())
+
+	bot := &robot{cnf: cnf, log: framework.NewLogger()}
+	data := bot.newCommentData(nil, org, repo, number, commenter, "https://gitcode.com/org1/repo1/pulls/1")
+	assert.Equal(t, "[@commenter1](https://gitcode.com/commenter1)", data.Commenter)
+	assert.Equal(t, "https://gitcode.com/org1/repo1/pulls/1", data.Link)
+
+	got := bot.comment(nil, templateCommentAddNotExistLabel, data.withLabels([]string{"kind/a", "kind/b"}))
+	assert.Equal(t, "### Label Command Feedback \n\n [@commenter1](https://gitcode.com/commenter1), "+
+		"Because of the repository doesn't have the label(s) `kind/a, kind/b`, it cannot be added. :pray: ", got)
+
+	got = bot.comment(nil, templateCommentLabelCommandConflict, data.withLabels([]string{"kind/a", "kind/b"}))
+	assert.Equal(t, "### Label Command Feedback \n\n [@commenter1](https://gitcode.com/commenter1) , "+
+		"the comment that add and delete a same label **kind/a**, **kind/b**, please check it. :pray: ", got)
+
+	// the data is not the type that the template expects
+	got = bot.comment(nil, templateCommentAddNotExistLabel, &commandReport{})
+	assert.Equal(t, "### Label Command Feedback \n\n , Because of the repository doesn't have the label(s) ``, "+
+		"it cannot be added. :pray: ", got)
+	got = bot.comment(nil, templateCommentCommandReport, &data)
+	assert.Equal(t, "", got)
+}
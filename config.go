@@ -14,96 +14,317 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/opensourceways/server-common-lib/config"
+	"github.com/sirupsen/logrus"
+	"maps"
 	"reflect"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"text/template"
 )
 
 // configuration holds a list of repoConfig configurations and .
 type configuration struct {
 	ConfigItems []repoConfig `json:"config_items,omitempty"`
 	// SquashCommitLabel Specify the label whose PR exceeds the threshold. default: stat/needs-squash
-	SquashCommitLabel                          string `json:"squash_commit_label" required:"true"`
-	UserMarkFormat                             string `json:"user_mark_format" required:"true"`
-	PlaceholderCommenter                       string `json:"placeholder_commenter" required:"true"`
-	CommentCommandTrigger                      string `json:"comment_command_trigger" required:"true"`
-	CommentRemoveLabelsWhenPRSourceCodeUpdated string `json:"comment_remove_labels_when_pr_source_code_updated" required:"true"`
-	CommentLabelCommandConflict                string `json:"comment_label_command_conflict" required:"true"`
-	CommentUpdateLabelFailed                   string `json:"comment_update_label_failed" required:"true"`
-	CommentAddNotExistLabel                    string `json:"comment_add_not_exist_label" required:"true"`
+	SquashCommitLabel string `json:"squash_commit_label" required:"true"`
+	// CommentTemplates are the global comment templates, they belong to the locale named default.
+	CommentTemplates
+	// Locales holds the comment templates in other languages keyed by the name of the locale, e.g. zh, en.
+	// Every locale must define every required template.
+	Locales map[string]CommentTemplates `json:"locales,omitempty"`
+
+	// templates holds the parsed comment templates keyed by the locale and the template name
+	templates map[string]map[string]*template.Template
+	// deprecations are the warnings about the deprecated parts which are converted when validating
+	deprecations []error
+	// warnings are the warnings about the valid parts which need attention, e.g. the platforms
+	// whose events must be posted by a dispatcher
+	warnings []error
 }
 
-// Validate to check the configmap data's validation, returns an error if invalid
+// Validate to check the configmap data's validation, returns an error if invalid.
+// All the problems of the configuration are reported together, each one is a configError.
 func (c *configuration) Validate() error {
 	if c == nil {
 		return errors.New("configuration is nil")
 	}
 
+	var errs []error
+	// the deprecations are kept if the configuration is validated again after converted
+	if warnings := c.convertLegacyTemplates(); len(warnings) != 0 {
+		c.deprecations = warnings
+	}
+	c.warnings = c.warnPlatforms()
+
 	// Validate each repo configuration
 	items := c.ConfigItems
 	for i := range items {
-		if err := items[i].validateRepoConfig(); err != nil {
-			return err
+		path := fmt.Sprintf("config_items[%d]", i)
+		itemErrs := items[i].validateRepoConfig()
+		for _, err := range itemErrs {
+			errs = append(errs, locate(path, err))
+		}
+		if len(itemErrs) != 0 {
+			continue
 		}
+		items[i].recordSetFields()
 
 		// Set the Default value, if it is not explicit in the config
 		if items[i].CommitsThreshold == 0 {
 			items[i].CommitsThreshold = 1
 		}
 
-		// Set the clear labels rules
-		if items[i].ClearLabelsByRegexp != "" {
-			r, err := regexp.Compile(items[i].ClearLabelsByRegexp)
-			if err != nil {
-				return err
+		if items[i].FeedbackMode == "" {
+			items[i].FeedbackMode = feedbackModeComment
+		}
+	}
+
+	if err := c.validateGlobalConfig(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := c.parseTemplates(); err != nil {
+		errs = append(errs, unjoin(err)...)
+	}
+
+	for i := range items {
+		path := fmt.Sprintf("config_items[%d]", i)
+		if err := items[i].parseTemplates(); err != nil {
+			for _, e := range unjoin(err) {
+				errs = append(errs, locate(path, e))
 			}
-			items[i].ClearLabelsRegexp = r
+		}
+
+		for _, locale := range items[i].Locales {
+			if _, ok := c.Locales[locale]; !ok && locale != defaultLocale {
+				errs = append(errs, locate(path+".locales", errors.New("unknown locale: "+locale)))
+			}
+		}
+		for _, locale := range sortedKeys(items[i].LocaleTemplates) {
+			if _, ok := c.Locales[locale]; !ok {
+				errs = append(errs, locate(path+".locale_templates", errors.New("unknown locale: "+locale)))
+			}
+		}
+
+		squashLabel := c.squashCommitLabel(&items[i])
+		if field := items[i].clearedBy(squashLabel); field != "" {
+			errs = append(errs, locate(path+"."+field,
+				errors.New("the squash commit label "+squashLabel+" would be cleared when the PR is updated")))
 		}
 	}
 
-	return c.validateGlobalConfig()
+	errs = append(errs, c.validateOverlaps()...)
+
+	return errors.Join(errs...)
+}
+
+// warnPlatforms returns the warnings about the items on the platforms other than GitCode,
+// the bot does not decode the webhooks of them.
+func (c *configuration) warnPlatforms() []error {
+	var warnings []error
+	for i := range c.ConfigItems {
+		if p := c.ConfigItems[i].Platform; p != "" && p != platformGitCode {
+			warnings = append(warnings, locate(fmt.Sprintf("config_items[%d].platform", i),
+				errors.New("the webhooks of "+p+" are not decoded by the bot, the events must be posted by a dispatcher")))
+		}
+	}
+
+	return warnings
+}
+
+// warn logs the deprecated parts and the other warnings of the configuration
+func (c *configuration) warn(log *logrus.Entry) {
+	for _, w := range append(slices.Clone(c.deprecations), c.warnings...) {
+		log.Warning(w.Error())
+	}
+}
+
+// validateOverlaps reports the repos, orgs or wildcards which are listed by several config items,
+// the items are ambiguous because they apply to the same repositories with the same specificity.
+// An org and a repo of it listed by separate items are not reported, the items are layered.
+func (c *configuration) validateOverlaps() []error {
+	var errs []error
+	listedBy := make(map[string]int)
+	for i := range c.ConfigItems {
+		for j, v := range c.ConfigItems[i].Repos {
+			if k, ok := listedBy[v]; ok && k != i {
+				errs = append(errs, locate(fmt.Sprintf("config_items[%d].repos[%d]", i, j),
+					fmt.Errorf("%s is also covered by config_items[%d], list it once, "+
+						"or list the org and the repo by separate items to layer them", v, k)))
+				continue
+			}
+			listedBy[v] = i
+		}
+	}
+
+	return errs
+}
+
+// configError is a problem of the configuration, path locates the problematic field
+// by the json keys, e.g. config_items[0].clear_labels, it is empty for the global problems.
+type configError struct {
+	path string
+	err  error
+}
+
+func (e *configError) Error() string {
+	if e.path == "" {
+		return e.err.Error()
+	}
+
+	return e.path + ": " + e.err.Error()
+}
+
+func (e *configError) Unwrap() error {
+	return e.err
+}
+
+// locate prefixes the path of err with path, err is regarded as a problem of the field of path if it is not located.
+func locate(path string, err error) error {
+	var e *configError
+	if !errors.As(err, &e) {
+		return &configError{path: path, err: err}
+	}
+
+	if e.path == "" {
+		return &configError{path: path, err: e.err}
+	}
+
+	sep := "."
+	if strings.HasPrefix(e.path, "[") {
+		sep = ""
+	}
+
+	return &configError{path: path + sep + e.path, err: e.err}
+}
+
+// unjoin splits the errors joined by errors.Join
+func unjoin(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+
+	return []error{err}
+}
+
+// sortedKeys returns the keys of m in order, so that the problems are reported in a stable order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
 }
 
 func (c *configuration) validateGlobalConfig() error {
-	k := reflect.TypeOf(*c)
-	v := reflect.ValueOf(*c)
+	if missing := missingRequired(c); len(missing) != 0 {
+		return errors.New("missing the follow config: " + strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// missingRequired returns the json keys of the empty string fields which are tagged with required,
+// including the ones of the embedded structs. The argument must be a pointer to struct.
+func missingRequired(ptr any) []string {
+	return missingRequiredFields(reflect.ValueOf(ptr).Elem())
+}
+
+func missingRequiredFields(v reflect.Value) []string {
+	k := v.Type()
 
 	var missing []string
 	n := k.NumField()
 	for i := 0; i < n; i++ {
+		if k.Field(i).Anonymous && k.Field(i).Type.Kind() == reflect.Struct {
+			missing = append(missing, missingRequiredFields(v.Field(i))...)
+			continue
+		}
+
 		tag := k.Field(i).Tag.Get("required")
-		if len(tag) > 0 {
-			s, _ := v.Field(i).Interface().(string)
-			if s == "" {
-				missing = append(missing, k.Field(i).Tag.Get("json"))
-			}
+		if len(tag) > 0 && v.Field(i).Kind() == reflect.String && v.Field(i).String() == "" {
+			missing = append(missing, k.Field(i).Tag.Get("json"))
 		}
 	}
 
-	if len(missing) != 0 {
-		return errors.New("missing the follow config: " + strings.Join(missing, ", "))
+	return missing
+}
+
+// squashCommitLabel returns the squash label of the repository, it falls back to the global one if not set
+func (c *configuration) squashCommitLabel(repoCnf *repoConfig) string {
+	if repoCnf != nil && repoCnf.SquashCommitLabel != "" {
+		return repoCnf.SquashCommitLabel
 	}
 
-	return nil
+	return c.SquashCommitLabel
 }
 
+// wildcardRepos in the repos of a config item applies the item to all organizations
+const wildcardRepos = "*"
+
+// the specificities of the ways which a config item applies to a repository, the greater the more specific
+const (
+	specificityNone = iota
+	specificityWildcard
+	specificityOrg
+	specificityRepo
+)
+
 // getRepoConfig retrieves a repoConfig for a given organization and repository.
+// The config items which apply to the repository are layered from the least specific to the most specific,
+// i.e. wildcard, org, org/repo, and each one only overrides the fields it sets on top of the less specific ones.
 // Returns the repoConfig if found, otherwise returns nil.
 func (c *configuration) getRepoConfig(org, repo string) *repoConfig {
 	if c == nil || len(c.ConfigItems) == 0 {
 		return nil
 	}
 
-	for i := range c.ConfigItems {
-		ok, _ := c.ConfigItems[i].RepoFilter.CanApply(org, org+"/"+repo)
-		if ok {
-			return &c.ConfigItems[i]
+	matched := c.matchRepoConfigs(org, repo)
+	switch len(matched) {
+	case 0:
+		return nil
+	case 1:
+		return &c.ConfigItems[matched[0]]
+	}
+
+	merged := c.ConfigItems[matched[0]]
+	if merged.templates != nil {
+		merged.templates = make(map[string]map[string]*template.Template, len(c.ConfigItems[matched[0]].templates))
+		for locale, t := range c.ConfigItems[matched[0]].templates {
+			merged.templates[locale] = maps.Clone(t)
 		}
 	}
+	for _, i := range matched[1:] {
+		merged.mergeFrom(&c.ConfigItems[i])
+	}
 
-	return nil
+	return &merged
+}
+
+// matchRepoConfigs returns the indexes of the config items which apply to the repository,
+// ordered from the least specific to the most specific. Among the items of the same specificity,
+// the one listed first in the config is the last, so that it takes precedence.
+func (c *configuration) matchRepoConfigs(org, repo string) []int {
+	var matched []int
+	for i := len(c.ConfigItems) - 1; i >= 0; i-- {
+		if c.ConfigItems[i].specificity(org, repo) != specificityNone {
+			matched = append(matched, i)
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return c.ConfigItems[matched[i]].specificity(org, repo) < c.ConfigItems[matched[j]].specificity(org, repo)
+	})
+
+	return matched
 }
 
 // repoConfig is a configuration struct for a organization and repository.
@@ -119,24 +340,357 @@ type repoConfig struct {
 	ClearLabelsByRegexp string         `json:"clear_labels_by_regexp,omitempty"`
 	ClearLabelsRegexp   *regexp.Regexp `json:"-,omitempty"`
 
+	// ClearLabelsPatterns specifies more patterns which match the labels that should be removed
+	// when the codes of PR are changed, they are in the syntax of ClearLabelsPatternSyntax.
+	ClearLabelsPatterns []string `json:"clear_labels_patterns,omitempty"`
+	// ExcludedClearLabelsPatterns specifies the patterns of the labels which should be kept although
+	// they match clear_labels_by_regexp or clear_labels_patterns, e.g. clear ^lgtm except lgtm-docs.
+	// The labels listed in clear_labels are removed anyway.
+	ExcludedClearLabelsPatterns []string `json:"excluded_clear_labels_patterns,omitempty"`
+	// ClearLabelsPatternSyntax is the syntax of the patterns of the item, it is regexp or glob. default: regexp
+	ClearLabelsPatternSyntax string `json:"clear_labels_pattern_syntax,omitempty"`
+	clearLabelsIncludes      []*regexp.Regexp
+	clearLabelsExcludes      []*regexp.Regexp
+
+	// SkipClearingOnRebase is a tag which will lead to keep the labels if it is true and
+	// the push leaves the changes of PR as they were, e.g. a pure rebase.
+	// It and ClearLabelsPaths compare with the previous push remembered by the process, so they need
+	// the bot to run as a single replica, see --pr-changes-size.
+	SkipClearingOnRebase bool `json:"skip_clearing_on_rebase,omitempty"`
+	// ClearLabelsPaths restricts removing a label to the pushes which change the files matching the paths,
+	// it is keyed by the label. The paths are globs matching the whole file path, e.g. src/*, *.go.
+	// The labels not listed are removed by any push.
+	ClearLabelsPaths        map[string][]string `json:"clear_labels_paths,omitempty"`
+	clearLabelsPathPatterns map[string][]*regexp.Regexp
+
+	// TrustedPushers specifies the users whose pushes do not lead to remove the labels, e.g. the maintainers
+	// who push small fixups to the PRs of the contributors.
+	TrustedPushers []string `json:"trusted_pushers,omitempty"`
+	// TrustCollaborators is a tag which will lead to trust the pushes of the users who have the permission
+	// of the repository if it is true.
+	TrustCollaborators bool `json:"trust_collaborators,omitempty"`
+
 	// AllowCreatingLabelsByCollaborator is a tag which will lead to create unavailable labels
 	// by collaborator if it is true.
 	AllowCreatingLabelsByCollaborator bool `json:"allow_creating_labels_by_collaborator,omitempty"`
 
+	// EditPreviousFeedback is a tag which will lead to edit the previous feedback comment of the bot
+	// on the same PR instead of posting a new one if it is true.
+	EditPreviousFeedback bool `json:"edit_previous_feedback,omitempty"`
+
+	// Platform specifies the code hosting platform which the repositories are on,
+	// it is one of gitcode, github, gitee and gitlab. default: gitcode
+	// The bot only decodes the webhooks of gitcode, the events of the other platforms must be posted
+	// by a dispatcher as the normalized events, see the Platforms section of the README.
+	Platform string `json:"platform,omitempty"`
+
+	// Credential specifies the name of the credential which the bot calls the API of the repositories with,
+	// e.g. one for each community, so that they have separate rate-limit budgets. default: the token of the bot
+	// The credential must be loaded from the credentials directory, or the config is rejected.
+	Credential string `json:"credential,omitempty"`
+
+	// DryRun is a tag which will lead to log the label and comment mutations of the repositories
+	// as the intended actions instead of executing them if it is true, e.g. before enabling the bot on an org.
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// CommentTemplates override the global comment templates of the default locale for the repositories.
+	CommentTemplates
+	// LocaleTemplates override the comment templates of the other locales for the repositories,
+	// keyed by the name of the locale.
+	LocaleTemplates map[string]CommentTemplates `json:"locale_templates,omitempty"`
+	// templates holds the parsed overrides keyed by the locale and the template name
+	templates map[string]map[string]*template.Template
+
+	// Locales specifies the locales which the comments are rendered in. If there are several locales,
+	// the renderings of them are combined into one comment. default: the global comment templates
+	Locales []string `json:"locales,omitempty"`
+
+	// FeedbackMode specifies how the bot responds to a label command comment,
+	// it is one of comment, reaction, both and none. default: comment
+	// The reaction and both modes are not supported on gitee and gitlab.
+	FeedbackMode string `json:"feedback_mode,omitempty"`
+
 	SquashConfig
+
+	// setFields holds the json keys of the fields set in the config
+	setFields map[string]bool
 }
 
-// validateRepoConfig to check the repoConfig data's validation, returns an error if invalid
-func (c *repoConfig) validateRepoConfig() error {
+// specificity returns how specifically the config item applies to the repository
+func (c *repoConfig) specificity(org, repo string) int {
+	orgRepo := org + "/" + repo
+	if ok, _ := c.RepoFilter.CanApply(org, orgRepo); ok {
+		if slices.Contains(c.Repos, orgRepo) {
+			return specificityRepo
+		}
+		return specificityOrg
+	}
+
+	if org != "" && slices.Contains(c.Repos, wildcardRepos) &&
+		!slices.Contains(c.ExcludedRepos, org) && !slices.Contains(c.ExcludedRepos, orgRepo) {
+		return specificityWildcard
+	}
+
+	return specificityNone
+}
+
+// UnmarshalJSON records the fields set in the config, they are the ones the item overrides when layered.
+func (c *repoConfig) UnmarshalJSON(data []byte) error {
+	type plainRepoConfig repoConfig
+	if err := json.Unmarshal(data, (*plainRepoConfig)(c)); err != nil {
+		return err
+	}
+
+	keys := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+
+	c.setFields = make(map[string]bool, len(keys))
+	for k := range keys {
+		c.setFields[k] = true
+	}
+
+	return nil
+}
+
+// recordSetFields regards the non-empty fields as the set ones, if the item is not loaded from the config.
+func (c *repoConfig) recordSetFields() {
+	if c.setFields != nil {
+		return
+	}
+
+	v := reflect.ValueOf(c).Elem()
+	c.setFields = make(map[string]bool)
+	walkLayeredFields(v.Type(), nil, func(name string, index []int) {
+		if !v.FieldByIndex(index).IsZero() {
+			c.setFields[name] = true
+		}
+	})
+}
+
+// isSet returns true if the field of the json key is set in the item
+func (c *repoConfig) isSet(name string, v reflect.Value) bool {
+	if c.setFields == nil {
+		return !v.IsZero()
+	}
+
+	return c.setFields[name]
+}
+
+// mergeFrom overrides the fields of c with the ones set in src, src is the more specific item.
+func (c *repoConfig) mergeFrom(src *repoConfig) {
+	dst := reflect.ValueOf(c).Elem()
+	from := reflect.ValueOf(src).Elem()
+	walkLayeredFields(dst.Type(), nil, func(name string, index []int) {
+		if !src.isSet(name, from.FieldByIndex(index)) {
+			return
+		}
+		dst.FieldByIndex(index).Set(from.FieldByIndex(index))
+
+		// the compiled patterns follow the ones they are compiled from
+		switch name {
+		case "clear_labels_by_regexp":
+			c.ClearLabelsRegexp = src.ClearLabelsRegexp
+		case "clear_labels_patterns":
+			c.clearLabelsIncludes = src.clearLabelsIncludes
+		case "excluded_clear_labels_patterns":
+			c.clearLabelsExcludes = src.clearLabelsExcludes
+		case "clear_labels_paths":
+			c.clearLabelsPathPatterns = src.clearLabelsPathPatterns
+		}
+		if c.templates != nil {
+			c.mergeTemplatesFrom(src, name)
+		}
+	})
+
+	if c.templates != nil && src.templates == nil {
+		// the templates of src are not parsed, parse the merged ones lazily
+		c.templates = nil
+	}
+	c.RepoFilter = src.RepoFilter
+}
+
+// mergeTemplatesFrom overrides the parsed templates of the field of the json key with the ones of src,
+// the field is either a template of the default locale or locale_templates.
+func (c *repoConfig) mergeTemplatesFrom(src *repoConfig, name string) {
+	if name == "locale_templates" {
+		for locale := range c.templates {
+			if locale != defaultLocale {
+				delete(c.templates, locale)
+			}
+		}
+		for locale, t := range src.templates {
+			if locale != defaultLocale {
+				c.templates[locale] = t
+			}
+		}
+		return
+	}
+
+	if t, ok := src.templates[defaultLocale][name]; ok {
+		if c.templates[defaultLocale] == nil {
+			c.templates[defaultLocale] = make(map[string]*template.Template)
+		}
+		c.templates[defaultLocale][name] = t
+	} else {
+		delete(c.templates[defaultLocale], name)
+	}
+}
+
+// walkLayeredFields calls fn with the json key and the index of each field of repoConfig
+// which can be overridden by a more specific item, the fields of the embedded structs are included.
+func walkLayeredFields(k reflect.Type, parent []int, fn func(name string, index []int)) {
+	n := k.NumField()
+	for i := 0; i < n; i++ {
+		f := k.Field(i)
+		index := append(slices.Clone(parent), i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			if f.Type != reflect.TypeOf(config.RepoFilter{}) {
+				walkLayeredFields(f.Type, index, fn)
+			}
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if !f.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		fn(name, index)
+	}
+}
+
+// validateRepoConfig to check the repoConfig data's validation, returns the problems located at the fields
+func (c *repoConfig) validateRepoConfig() []error {
+	var errs []error
+
 	// If the bot is not configured to monitor any repositories, return an error.
 	if len(c.Repos) == 0 {
-		return errors.New("the repositories configuration can not be empty")
+		errs = append(errs, locate("repos", errors.New("the repositories configuration can not be empty")))
+	}
+
+	switch c.FeedbackMode {
+	case "", feedbackModeComment, feedbackModeReaction, feedbackModeBoth, feedbackModeNone:
+	default:
+		errs = append(errs, locate("feedback_mode", errors.New("unsupported feedback mode: "+c.FeedbackMode)))
+	}
+
+	switch c.Platform {
+	case "", platformGitCode, platformGitHub, platformGitee, platformGitLab:
+	default:
+		errs = append(errs, locate("platform", errors.New("unsupported platform: "+c.Platform)))
+	}
+
+	// Gitee and GitLab have no reactions to the comments which the bot can create
+	if (c.Platform == platformGitee || c.Platform == platformGitLab) &&
+		(c.FeedbackMode == feedbackModeReaction || c.FeedbackMode == feedbackModeBoth) {
+		errs = append(errs, locate("feedback_mode",
+			errors.New("the feedback mode "+c.FeedbackMode+" is not supported on "+c.Platform)))
+	}
+
+	for i, v := range c.ExcludedRepos {
+		if slices.Contains(c.Repos, v) {
+			errs = append(errs, locate(fmt.Sprintf("excluded_repos[%d]", i),
+				errors.New(v+" exists in both repos and excluded_repos")))
+		}
+	}
+
+	// Set the clear labels rules
+	if c.ClearLabelsByRegexp != "" {
+		r, err := regexp.Compile(c.ClearLabelsByRegexp)
+		if err != nil {
+			errs = append(errs, locate("clear_labels_by_regexp", err))
+		}
+		c.ClearLabelsRegexp = r
+	}
+
+	switch c.ClearLabelsPatternSyntax {
+	case "", patternSyntaxRegexp, patternSyntaxGlob:
+	default:
+		errs = append(errs, locate("clear_labels_pattern_syntax",
+			errors.New("unsupported pattern syntax: "+c.ClearLabelsPatternSyntax)))
+	}
+
+	var patternErrs []error
+	c.clearLabelsIncludes, patternErrs = c.compilePatterns("clear_labels_patterns", c.ClearLabelsPatterns)
+	errs = append(errs, patternErrs...)
+	c.clearLabelsExcludes, patternErrs = c.compilePatterns("excluded_clear_labels_patterns", c.ExcludedClearLabelsPatterns)
+	errs = append(errs, patternErrs...)
+
+	c.clearLabelsPathPatterns = nil
+	for _, l := range sortedKeys(c.ClearLabelsPaths) {
+		if c.clearLabelsPathPatterns == nil {
+			c.clearLabelsPathPatterns = make(map[string][]*regexp.Regexp, len(c.ClearLabelsPaths))
+		}
+		for i, p := range c.ClearLabelsPaths[l] {
+			r, err := compilePattern(p, patternSyntaxGlob)
+			if err != nil {
+				errs = append(errs, locate(fmt.Sprintf("clear_labels_paths.%s[%d]", l, i), err))
+				continue
+			}
+			c.clearLabelsPathPatterns[l] = append(c.clearLabelsPathPatterns[l], r)
+		}
+	}
+
+	return errs
+}
+
+// compilePatterns compiles the patterns of the field of name in the syntax of the item
+func (c *repoConfig) compilePatterns(name string, patterns []string) ([]*regexp.Regexp, []error) {
+	var errs []error
+	var compiled []*regexp.Regexp
+	for i, p := range patterns {
+		r, err := compilePattern(p, c.ClearLabelsPatternSyntax)
+		if err != nil {
+			errs = append(errs, locate(fmt.Sprintf("%s[%d]", name, i), err))
+			continue
+		}
+		compiled = append(compiled, r)
+	}
+
+	return compiled, errs
+}
+
+// hasClearLabelsRules returns true if any label should be removed when the codes of PR are changed
+func (c *repoConfig) hasClearLabelsRules() bool {
+	return len(c.ClearLabels) != 0 || c.ClearLabelsRegexp != nil || len(c.clearLabelsIncludes) != 0
+}
+
+// hasClearLabelsConditions returns true if removing the labels depends on what the push changes
+func (c *repoConfig) hasClearLabelsConditions() bool {
+	return c.SkipClearingOnRebase || len(c.ClearLabelsPaths) != 0
+}
+
+// matchClearLabelsPatterns returns true if the label matches the clear patterns but none of the excluded ones
+func (c *repoConfig) matchClearLabelsPatterns(label string) bool {
+	if (c.ClearLabelsRegexp == nil || !c.ClearLabelsRegexp.MatchString(label)) &&
+		!matchAnyPattern(label, c.clearLabelsIncludes) {
+		return false
+	}
+
+	return !matchAnyPattern(label, c.clearLabelsExcludes)
+}
+
+// clearedBy returns the json key of the field which clears the label when the PR is updated, or empty if none does
+func (c *repoConfig) clearedBy(label string) string {
+	switch {
+	case slices.Contains(c.ClearLabels, label):
+		return "clear_labels"
+	case matchAnyPattern(label, c.clearLabelsExcludes):
+		return ""
+	case c.ClearLabelsRegexp != nil && c.ClearLabelsRegexp.MatchString(label):
+		return "clear_labels_by_regexp"
+	case matchAnyPattern(label, c.clearLabelsIncludes):
+		return "clear_labels_patterns"
 	}
 
-	return c.RepoFilter.Validate()
+	return ""
 }
 
 type SquashConfig struct {
+	// SquashCommitLabel overrides the global squash_commit_label for the repositories.
+	SquashCommitLabel string `json:"squash_commit_label,omitempty"`
+
 	// UnableCheckingSquash indicates whether unable checking squash.
 	UnableCheckingSquash bool `json:"unable_checking_squash,omitempty"`
 
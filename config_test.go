@@ -15,6 +15,7 @@ package main
 
 import (
 	"errors"
+	"github.com/opensourceways/server-common-lib/config"
 	"github.com/opensourceways/server-common-lib/utils"
 	"github.com/stretchr/testify/assert"
 	"os"
@@ -22,6 +23,10 @@ import (
 	"testing"
 )
 
+const missingGlobalConfig = "missing the follow config: squash_commit_label, user_mark_format, " +
+	"comment_command_trigger, comment_remove_labels_when_pr_source_code_updated, " +
+	"comment_label_command_conflict, comment_update_label_failed, comment_add_not_exist_label"
+
 func TestValidate(t *testing.T) {
 
 	type args struct {
@@ -48,9 +53,7 @@ func TestValidate(t *testing.T) {
 				&configuration{},
 				"",
 			},
-			[2]error{nil, errors.New("missing the follow config: squash_commit_label, user_mark_format, " +
-				"placeholder_commenter, comment_command_trigger, comment_remove_labels_when_pr_source_code_updated, " +
-				"comment_label_command_conflict, comment_update_label_failed, comment_add_not_exist_label")},
+			[2]error{nil, errors.New(missingGlobalConfig)},
 		},
 		{
 			"no valid org or repo in the config",
@@ -58,7 +61,8 @@ func TestValidate(t *testing.T) {
 				&configuration{},
 				"config1.yaml",
 			},
-			[2]error{nil, errors.New("the repositories configuration can not be empty")},
+			[2]error{nil, errors.New("config_items[0].repos: the repositories configuration can not be empty\n" +
+				missingGlobalConfig)},
 		},
 		{
 			"the same org and repo conflicts in the config",
@@ -66,7 +70,42 @@ func TestValidate(t *testing.T) {
 				&configuration{},
 				"config2.yaml",
 			},
-			[2]error{nil, errors.New("some org or org/repo exists in both repos and excluded_repos")},
+			[2]error{nil, errors.New("config_items[0].excluded_repos[0]: owner2/repo1 exists in both repos and excluded_repos\n" +
+				missingGlobalConfig)},
+		},
+		{
+			"unsupported feedback mode in the config",
+			args{
+				&configuration{ConfigItems: []repoConfig{
+					{RepoFilter: config.RepoFilter{Repos: []string{"owner1"}}, FeedbackMode: "emoji"},
+				}},
+				"",
+			},
+			[2]error{nil, errors.New("config_items[0].feedback_mode: unsupported feedback mode: emoji\n" +
+				missingGlobalConfig)},
+		},
+		{
+			"unsupported platform in the config",
+			args{
+				&configuration{ConfigItems: []repoConfig{
+					{RepoFilter: config.RepoFilter{Repos: []string{"owner1"}}, Platform: "bitbucket"},
+				}},
+				"",
+			},
+			[2]error{nil, errors.New("config_items[0].platform: unsupported platform: bitbucket\n" +
+				missingGlobalConfig)},
+		},
+		{
+			"reaction feedback on gitlab",
+			args{
+				&configuration{ConfigItems: []repoConfig{
+					{RepoFilter: config.RepoFilter{Repos: []string{"owner1"}}, Platform: platformGitLab,
+						FeedbackMode: feedbackModeBoth},
+				}},
+				"",
+			},
+			[2]error{nil, errors.New("config_items[0].feedback_mode: the feedback mode both is not supported on gitlab\n" +
+				missingGlobalConfig)},
 		},
 		{
 			"a correct config",
@@ -85,12 +124,117 @@ func TestValidate(t *testing.T) {
 			}
 
 			err1 := testCases[i].in.cnf.Validate()
-			assert.Equal(t, testCases[i].out[1], err1)
+			if testCases[i].out[1] == nil {
+				assert.Nil(t, err1)
+			} else {
+				assert.EqualError(t, err1, testCases[i].out[1].Error())
+			}
 		})
 	}
 
 }
 
+func TestValidateTemplates(t *testing.T) {
+	cnf := &configuration{}
+	err := utils.LoadFromYaml(findTestdata(t, configYaml), cnf)
+	assert.Nil(t, err)
+
+	cnf.ConfigItems[0].Locales = []string{"zh"}
+	assert.EqualError(t, cnf.Validate(), "config_items[0].locales: unknown locale: zh")
+	cnf.ConfigItems[0].Locales = nil
+	cnf.ConfigItems[0].LocaleTemplates = map[string]CommentTemplates{"zh": {}}
+	assert.EqualError(t, cnf.Validate(), "config_items[0].locale_templates: unknown locale: zh")
+	cnf.ConfigItems[0].LocaleTemplates = nil
+
+	cnf.ConfigItems[1].CommentAddNotExistLabel = "{{.Commenter}"
+	assert.ErrorContains(t, cnf.Validate(), "config_items[1].comment_add_not_exist_label: invalid template: ")
+	cnf.ConfigItems[1].CommentAddNotExistLabel = ""
+
+	cnf.CommentCommandTrigger = "%s, the labels are updated."
+	assert.EqualError(t, cnf.Validate(), "comment_command_trigger: invalid template: "+
+		"the fmt verb %s is not supported, refer to the data by the fields instead, e.g. {{.Commenter}}")
+	cnf.CommentCommandTrigger = "the labels are updated."
+
+	cnf.CommentUpdateLabelFailed = "%s, Because of the label update failed, please comment once again."
+	cnf.ConfigItems[1].PlaceholderCommenter = "<commenter>"
+	cnf.ConfigItems[1].UserMarkFormat = "@<commenter>"
+	cnf.ConfigItems[1].CommentAddNotExistLabel = "%s, 100%% missing `%s`"
+	assert.Nil(t, cnf.Validate())
+	assert.Equal(t, "{{.Commenter}}, Because of the label update failed, please comment once again.",
+		cnf.CommentUpdateLabelFailed)
+	assert.Equal(t, "@{{.Commenter}}", cnf.ConfigItems[1].UserMarkFormat)
+	assert.Equal(t, "{{.Commenter}}, 100% missing `{{join .Labels \", \"}}`", cnf.ConfigItems[1].CommentAddNotExistLabel)
+	assert.Equal(t, []string{
+		"comment_update_label_failed: the fmt verb %s is deprecated, converted to " +
+			"{{.Commenter}}, Because of the label update failed, please comment once again.",
+		"config_items[1].placeholder_commenter: deprecated, user_mark_format is converted to @{{.Commenter}}",
+		"config_items[1].comment_add_not_exist_label: the fmt verb %s is deprecated, converted to " +
+			"{{.Commenter}}, 100% missing `{{join .Labels \", \"}}`",
+	}, errorStrings(cnf.deprecations))
+	cnf.ConfigItems[1].UserMarkFormat = ""
+	cnf.ConfigItems[1].CommentAddNotExistLabel = ""
+
+	cnf.CommentUpdateLabelFailed = "{{.Commenter}, Because of the label update failed, please comment once again."
+	assert.ErrorContains(t, cnf.Validate(), "comment_update_label_failed: invalid template: ")
+}
+
+func TestValidateContradictions(t *testing.T) {
+	cnf := &configuration{}
+	err := utils.LoadFromYaml(findTestdata(t, configYaml), cnf)
+	assert.Nil(t, err)
+
+	cnf.ConfigItems[0].Repos = append(cnf.ConfigItems[0].Repos, "owner3", "owner2/repo1")
+	cnf.ConfigItems[1].ExcludedRepos = []string{"owner3/repo1", "owner4/repo2"}
+	cnf.ConfigItems[1].ClearLabels = append(cnf.ConfigItems[1].ClearLabels, "stat/needs-squash")
+	cnf.ConfigItems[1].ClearLabelsByRegexp = "lgtm-("
+	cnf.ConfigItems[0].SquashCommitLabel = "ci_successful"
+	cnf.ConfigItems = append(cnf.ConfigItems, repoConfig{
+		RepoFilter:          config.RepoFilter{Repos: []string{"owner1/repo5"}},
+		ClearLabelsPatterns: []string{"^stat/"},
+	}, repoConfig{
+		RepoFilter:          config.RepoFilter{Repos: []string{"owner1/repo6"}},
+		ClearLabelsByRegexp: "^stat/",
+	})
+
+	// all the problems are reported together
+	assert.EqualError(t, cnf.Validate(), "config_items[1].excluded_repos[1]: owner4/repo2 exists in both repos and excluded_repos\n"+
+		"config_items[1].clear_labels_by_regexp: error parsing regexp: missing closing ): `lgtm-(`\n"+
+		"config_items[0].clear_labels: the squash commit label ci_successful would be cleared when the PR is updated\n"+
+		"config_items[1].clear_labels: the squash commit label stat/needs-squash would be cleared when the PR is updated\n"+
+		"config_items[2].clear_labels_patterns: the squash commit label stat/needs-squash would be cleared when the PR is updated\n"+
+		"config_items[3].clear_labels_by_regexp: the squash commit label stat/needs-squash would be cleared when the PR is updated\n"+
+		"config_items[1].repos[0]: owner3 is also covered by config_items[0], list it once, "+
+		"or list the org and the repo by separate items to layer them")
+}
+
+func TestValidateClearLabelsPatterns(t *testing.T) {
+	cnf := &repoConfig{
+		RepoFilter:                  config.RepoFilter{Repos: []string{"owner1"}},
+		ClearLabelsPatterns:         []string{"^lgtm", "(approved"},
+		ExcludedClearLabelsPatterns: []string{"lgtm-docs["},
+		ClearLabelsPatternSyntax:    "wildcard",
+	}
+	errs := cnf.validateRepoConfig()
+	assert.Equal(t, 3, len(errs))
+	assert.EqualError(t, errs[0], "clear_labels_pattern_syntax: unsupported pattern syntax: wildcard")
+	assert.ErrorContains(t, errs[1], "clear_labels_patterns[1]: error parsing regexp: ")
+	assert.ErrorContains(t, errs[2], "excluded_clear_labels_patterns[0]: error parsing regexp: ")
+
+	cnf.ClearLabelsPatternSyntax = patternSyntaxGlob
+	assert.Nil(t, cnf.validateRepoConfig())
+	assert.Equal(t, true, cnf.hasClearLabelsRules())
+	assert.Equal(t, true, cnf.matchClearLabelsPatterns("(approved"))
+	assert.Equal(t, false, cnf.matchClearLabelsPatterns("approved"))
+	assert.Equal(t, false, cnf.matchClearLabelsPatterns("lgtm-docs["))
+}
+
+func TestSquashCommitLabel(t *testing.T) {
+	cnf := &configuration{SquashCommitLabel: "stat/needs-squash"}
+	assert.Equal(t, "stat/needs-squash", cnf.squashCommitLabel(nil))
+	assert.Equal(t, "stat/needs-squash", cnf.squashCommitLabel(&repoConfig{}))
+	assert.Equal(t, "squash", cnf.squashCommitLabel(&repoConfig{SquashConfig: SquashConfig{SquashCommitLabel: "squash"}}))
+}
+
 func TestGetRepoConfig(t *testing.T) {
 	cnf := &configuration{}
 	got := cnf.getRepoConfig("owner1", "")
@@ -141,6 +285,41 @@ func TestGetRepoConfig(t *testing.T) {
 	}
 }
 
+func TestGetLayeredRepoConfig(t *testing.T) {
+	cnf := &configuration{}
+	err := utils.LoadFromYaml(findTestdata(t, "config3.yaml"), cnf)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, cnf.Validate())
+
+	// the wildcard item applies to the orgs which are not configured
+	got := cnf.getRepoConfig("owner2", "repo1")
+	assert.Equal(t, &cnf.ConfigItems[0], got)
+	assert.Equal(t, (*repoConfig)(nil), cnf.getRepoConfig("owner9", "repo1"))
+
+	// the org item overrides the wildcard item although it is listed later
+	got = cnf.getRepoConfig("owner1", "repo2")
+	assert.Equal(t, []string{"lgtm", "approved"}, got.ClearLabels)
+	assert.Equal(t, "lgtm-", got.ClearLabelsRegexp.String())
+	assert.Equal(t, uint(3), got.CommitsThreshold)
+	assert.Equal(t, feedbackModeReaction, got.FeedbackMode)
+	assert.Equal(t, []string{"owner1"}, got.Repos)
+
+	// the repo item only overrides the fields it sets
+	got = cnf.getRepoConfig("owner1", "repo1")
+	assert.Equal(t, []string{}, got.ClearLabels)
+	assert.Equal(t, "lgtm-", got.ClearLabelsRegexp.String())
+	assert.Equal(t, uint(3), got.CommitsThreshold)
+	assert.Equal(t, true, got.UnableCheckingSquash)
+	assert.Equal(t, feedbackModeReaction, got.FeedbackMode)
+	s, err := cnf.render(got, templateCommentCommandTrigger, &commentData{Commenter: "@commenter"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "@commenter, please comment once again.", s)
+
+	// the items are not modified by the merging
+	assert.Equal(t, 0, len(cnf.ConfigItems[1].templates))
+	assert.Equal(t, false, cnf.ConfigItems[1].UnableCheckingSquash)
+}
+
 func findTestdata(t *testing.T, path string) string {
 	path = "testdata" + string(os.PathSeparator) + path
 	i := 0
@@ -163,3 +342,24 @@ retry:
 	t.Log(path + " not found")
 	return ""
 }
+
+func errorStrings(errs []error) []string {
+	s := make([]string, 0, len(errs))
+	for _, err := range errs {
+		s = append(s, err.Error())
+	}
+
+	return s
+}
+
+func TestWarnPlatforms(t *testing.T) {
+	cnf, problems := loadConfigFile(findTestdata(t, "config3.yaml"))
+	assert.Nil(t, problems)
+	assert.Empty(t, cnf.warnings)
+
+	// the items on the other platforms are valid, but their events must be posted by a dispatcher
+	cnf.ConfigItems[1].Platform = platformGitHub
+	assert.Nil(t, cnf.Validate())
+	assert.Equal(t, []string{"config_items[1].platform: the webhooks of github are not decoded by the bot, " +
+		"the events must be posted by a dispatcher"}, errorStrings(cnf.warnings))
+}
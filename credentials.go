@@ -0,0 +1,92 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// loadCredentials returns the token sources and the tokens of the named credentials in the directory, each file
+// holds the token of the credential named by the file name. The hidden files are skipped, e.g. ..data of a mounted secret.
+func loadCredentials(dir string) (map[string]*tokenSource, map[string][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sources := make(map[string]*tokenSource, len(entries))
+	tokens := make(map[string][]byte, len(entries))
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") || e.IsDir() {
+			continue
+		}
+		// the files are watched, so that the tokens are rotated in the same way as the token of the bot
+		src, err := newTokenSource(tokenSourceWatch, filepath.Join(dir, e.Name()), "")
+		if err != nil {
+			return nil, nil, err
+		}
+		if tokens[e.Name()], _, err = src.refresh(); err != nil {
+			return nil, nil, fmt.Errorf("credential %s: %w", e.Name(), err)
+		}
+		sources[e.Name()] = src
+	}
+
+	return sources, tokens, nil
+}
+
+// credentialNames returns the names of the credentials in order
+func credentialNames(sources map[string]*tokenSource) []string {
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// withCredential returns a copy of the bot which calls the API of the repository with the credential
+// of the config item, the bot itself is returned if the item uses the token of the bot.
+// It returns false if the credential is unknown, the event of the repository is not handled then,
+// since the token of the bot may not be meant for the repository.
+func (bot *robot) withCredential(org, repo string) (*robot, bool) {
+	repoCnf := bot.cnf.getRepoConfig(org, repo)
+	if repoCnf == nil || repoCnf.Credential == "" {
+		return bot, true
+	}
+
+	cli, ok := bot.credentials[repoCnf.Credential]
+	if !ok {
+		bot.log.Errorf("unknown credential %s of %s/%s, the event is not handled", repoCnf.Credential, org, repo)
+		return nil, false
+	}
+
+	b := *bot
+	b.cli = bot.wrapClient(cli)
+
+	return &b, true
+}
+
+// rotateCredentials swaps the clients of the named credentials whose tokens changed
+func (bot *robot) rotateCredentials(sources map[string]*tokenSource) {
+	for _, name := range credentialNames(sources) {
+		if cli, ok := bot.credentials[name]; ok {
+			bot.rotateClient(sources[name], name, cli, bot.log.WithField("credential", name))
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"github.com/opensourceways/robot-framework-lib/client"
+	"github.com/opensourceways/robot-framework-lib/framework"
+	"github.com/opensourceways/robot-universal-label/fakeclient"
+	"github.com/opensourceways/server-common-lib/config"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCredentials(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "openeuler"), []byte("token1\n"), 0o600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, ".hidden"), []byte("token"), 0o600))
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "..data"), 0o700))
+	sources, tokens, err := loadCredentials(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"openeuler"}, credentialNames(sources))
+	assert.Equal(t, map[string][]byte{"openeuler": []byte("token1")}, tokens)
+
+	clients := map[string]*fakeclient.Client{"default": fakeclient.New(), "token1": fakeclient.New(), "token2": fakeclient.New()}
+	for _, c := range clients {
+		c.AddRepo("owner1", "repo1", "kind/bug").OpenPR(number)
+		c.AddRepo("owner2", "repo1", "kind/bug").OpenPR(number)
+	}
+	cnf := &configuration{ConfigItems: []repoConfig{
+		{RepoFilter: config.RepoFilter{Repos: []string{"owner1"}}, Credential: "openeuler"},
+		{RepoFilter: config.RepoFilter{Repos: []string{"owner2"}}},
+		{RepoFilter: config.RepoFilter{Repos: []string{"owner3"}}, Credential: "unknown"},
+	}, SquashCommitLabel: "stat/needs-squash"}
+	bot := &robot{cnf: cnf, log: framework.NewLogger(), changes: newPRChanges(),
+		clientOf: func(_ string, token []byte) iClient { return clients[string(token)] }}
+	bot.cli = bot.wrapClient(clients["default"])
+	bot.credentials = map[string]*rotatingClient{"openeuler": newRotatingClient(clients["token1"])}
+
+	// the client is chosen by the config item of the repository of the event
+	evtRepo, evtNumber, evtComment, evtCommenter := "repo1", number, "/kind bug", "alice"
+	comment := func(org string) *client.GenericEvent {
+		return &client.GenericEvent{
+			Org: &org, Repo: &evtRepo, Number: &evtNumber, Comment: &evtComment, Commenter: &evtCommenter,
+		}
+	}
+	bot.handlePullRequestCommentEvent(comment("owner1"), cnf, bot.log)
+	assert.Equal(t, []string{"kind/bug"}, clients["token1"].PRLabels("owner1", "repo1", number))
+	assert.Nil(t, clients["default"].PRLabels("owner1", "repo1", number))
+
+	bot.handlePullRequestCommentEvent(comment("owner2"), cnf, bot.log)
+	assert.Equal(t, []string{"kind/bug"}, clients["default"].PRLabels("owner2", "repo1", number))
+	assert.Nil(t, clients["token1"].PRLabels("owner2", "repo1", number))
+
+	// the event of the unknown credential is not handled, rather than with the token of the bot
+	_, ok := bot.withCredential("owner3", "repo1")
+	assert.False(t, ok)
+	calls := len(clients["default"].Calls())
+	bot.handlePullRequestCommentEvent(comment("owner3"), cnf, bot.log)
+	assert.Equal(t, calls, len(clients["default"].Calls()))
+	// the config which references it is rejected
+	assert.EqualError(t, (&robotOptions{credentials: sources}).checkConfig(cnf),
+		"config_items[2].credential: unknown credential: unknown")
+
+	// the tokens of the credentials are rotated
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "openeuler"), []byte("token2"), 0o600))
+	bot.rotateCredentials(sources)
+	bot.handlePullRequestCommentEvent(comment("owner1"), cnf, bot.log)
+	assert.Equal(t, []string{"kind/bug"}, clients["token2"].PRLabels("owner1", "repo1", number))
+
+	_, _, err = loadCredentials(filepath.Join(dir, "missing"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,112 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// dryRunClient intercepts the mutations of the repositories in the dry-run mode, they are logged
+// as the intended actions and regarded as successful instead of executed. The reads still go to the real API.
+type dryRunClient struct {
+	iClient
+	// dryRun returns true if the repository is in the dry-run mode
+	dryRun func(org, repo string) bool
+	log    *logrus.Entry
+}
+
+// intercept returns true if the mutation of the repository is not executed, and logs it as an intended action
+func (c *dryRunClient) intercept(method, org, repo string, fields logrus.Fields) bool {
+	if !c.dryRun(org, repo) {
+		return false
+	}
+
+	c.log.WithFields(fields).WithField("method", method).Infof("dry run: intercepted the mutation of %s/%s", org, repo)
+	return true
+}
+
+func (c *dryRunClient) CreatePRComment(org, repo, number, comment string) bool {
+	if c.intercept("CreatePRComment", org, repo, logrus.Fields{"number": number, "comment": comment}) {
+		return true
+	}
+	return c.iClient.CreatePRComment(org, repo, number, comment)
+}
+
+func (c *dryRunClient) CreateIssueComment(org, repo, number, comment string) bool {
+	if c.intercept("CreateIssueComment", org, repo, logrus.Fields{"number": number, "comment": comment}) {
+		return true
+	}
+	return c.iClient.CreateIssueComment(org, repo, number, comment)
+}
+
+func (c *dryRunClient) AddIssueLabels(org, repo, number string, labels []string) bool {
+	if c.intercept("AddIssueLabels", org, repo, logrus.Fields{"number": number, "labels": labels}) {
+		return true
+	}
+	return c.iClient.AddIssueLabels(org, repo, number, labels)
+}
+
+func (c *dryRunClient) RemoveIssueLabels(org, repo, number string, labels []string) bool {
+	if c.intercept("RemoveIssueLabels", org, repo, logrus.Fields{"number": number, "labels": labels}) {
+		return true
+	}
+	return c.iClient.RemoveIssueLabels(org, repo, number, labels)
+}
+
+func (c *dryRunClient) AddPRLabels(org, repo, number string, labels []string) bool {
+	if c.intercept("AddPRLabels", org, repo, logrus.Fields{"number": number, "labels": labels}) {
+		return true
+	}
+	return c.iClient.AddPRLabels(org, repo, number, labels)
+}
+
+func (c *dryRunClient) RemovePRLabels(org, repo, number string, labels []string) bool {
+	if c.intercept("RemovePRLabels", org, repo, logrus.Fields{"number": number, "labels": labels}) {
+		return true
+	}
+	return c.iClient.RemovePRLabels(org, repo, number, labels)
+}
+
+func (c *dryRunClient) CreatePRCommentReaction(org, repo, commentID, reaction string) bool {
+	if c.intercept("CreatePRCommentReaction", org, repo, logrus.Fields{"comment_id": commentID, "reaction": reaction}) {
+		return true
+	}
+	return c.iClient.CreatePRCommentReaction(org, repo, commentID, reaction)
+}
+
+func (c *dryRunClient) CreateIssueCommentReaction(org, repo, commentID, reaction string) bool {
+	if c.intercept("CreateIssueCommentReaction", org, repo, logrus.Fields{"comment_id": commentID, "reaction": reaction}) {
+		return true
+	}
+	return c.iClient.CreateIssueCommentReaction(org, repo, commentID, reaction)
+}
+
+func (c *dryRunClient) UpdatePRComment(org, repo, commentID, comment string) bool {
+	if c.intercept("UpdatePRComment", org, repo, logrus.Fields{"comment_id": commentID, "comment": comment}) {
+		return true
+	}
+	return c.iClient.UpdatePRComment(org, repo, commentID, comment)
+}
+
+// dryRun returns true if the mutations of the repository are intercepted,
+// either the bot or the config of the repository is in the dry-run mode.
+func (bot *robot) dryRun(org, repo string) bool {
+	if bot.dryRunAll {
+		return true
+	}
+
+	// the client is shared by the events, so it follows the current configuration
+	repoCnf := bot.currentConfig().getRepoConfig(org, repo)
+	return repoCnf != nil && repoCnf.DryRun
+}
@@ -0,0 +1,74 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"github.com/opensourceways/robot-framework-lib/framework"
+	"github.com/opensourceways/server-common-lib/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	mc := &mockClient{successfulGetPullRequestLabels: true, labels: []string{"lgtm"}}
+	var out bytes.Buffer
+	bot := &robot{log: framework.NewLogger(), auditor: &writerSink{w: &out}, cnf: &configuration{ConfigItems: []repoConfig{
+		{RepoFilter: config.RepoFilter{Repos: []string{"owner1"}}, DryRun: true},
+		{RepoFilter: config.RepoFilter{Repos: []string{"owner2"}}},
+	}}}
+	bot.cli = &dryRunClient{iClient: mc, dryRun: bot.dryRun, log: bot.log}
+
+	// the mutations of the repository in the dry-run mode are intercepted, and not audited
+	report := &commandReport{commentData: commentData{Org: "owner1", Repo: repo, Number: number}}
+	bot.addPRLabels("owner1", repo, number, []string{"kind/bug"}, report)
+	assert.Equal(t, []string{"kind/bug"}, report.Added)
+	assert.True(t, bot.cli.CreatePRComment("owner1", repo, number, "comment"))
+	assert.Equal(t, "", mc.method)
+	assert.Equal(t, "", out.String())
+
+	// the reads still go to the real API
+	labels, success := bot.cli.GetPullRequestLabels("owner1", repo, number)
+	assert.True(t, success)
+	assert.Equal(t, []string{"lgtm"}, labels)
+	assert.Equal(t, "GetPullRequestLabels", mc.method)
+
+	// the other repositories are not in the dry-run mode
+	report = &commandReport{commentData: commentData{Org: "owner2", Repo: repo, Number: number}}
+	bot.addPRLabels("owner2", repo, number, []string{"kind/bug"}, report)
+	assert.Equal(t, "AddPRLabels", mc.method)
+	assert.Equal(t, []string{"kind/bug"}, report.AddFailed)
+	assert.Contains(t, out.String(), `"org":"owner2"`)
+
+	// unless the bot is in the dry-run mode
+	bot.dryRunAll = true
+	mc.method = ""
+	assert.True(t, bot.cli.RemovePRLabels("owner2", repo, number, []string{"lgtm"}))
+	assert.True(t, bot.cli.CreatePRCommentReaction("owner3", repo, "1", reactionSuccess))
+	assert.Equal(t, "", mc.method)
+}
+
+func TestDryRunNotObserved(t *testing.T) {
+	bot := &robot{log: framework.NewLogger(), metrics: newRobotMetrics(), dryRunAll: true, cnf: &configuration{}}
+	bot.cli = bot.wrapClient(&mockClient{successfulGetPullRequestLabels: true})
+
+	// the intercepted mutations are not the calls to the platform
+	assert.True(t, bot.cli.AddPRLabels(org, repo, number, []string{"kind/bug"}))
+	assert.Equal(t, 0, testutil.CollectAndCount(bot.metrics.clientDurations))
+
+	_, success := bot.cli.GetPullRequestLabels(org, repo, number)
+	assert.True(t, success)
+	assert.Equal(t, 1, testutil.CollectAndCount(bot.metrics.clientDurations))
+}
@@ -0,0 +1,94 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"github.com/opensourceways/robot-framework-lib/client"
+	"github.com/opensourceways/robot-framework-lib/framework"
+	"github.com/opensourceways/robot-universal-label/fakeclient"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var _ iClient = fakeclient.New()
+
+func TestCommentThenPushScenario(t *testing.T) {
+	cnf, problems := loadConfigFile(findTestdata(t, "config3.yaml"))
+	assert.Nil(t, problems)
+
+	fake := fakeclient.New()
+	r := fake.AddRepo("owner2", "repo1", "kind/bug", "lgtm")
+	r.Collaborators = []string{"alice"}
+	pr := r.OpenPR(number, client.PRCommit{AuthorName: "bob"})
+	bot := &robot{cli: fake, cnf: cnf, log: framework.NewLogger(), changes: newPRChanges()}
+
+	event := func(fields map[string]string) *client.GenericEvent {
+		evt := &client.GenericEvent{}
+		for k, v := range map[string]string{"org": "owner2", "repo": "repo1", "number": number, "state": "opened"} {
+			if _, ok := fields[k]; !ok {
+				fields[k] = v
+			}
+		}
+		ptrs := map[string]**string{
+			"org": &evt.Org, "repo": &evt.Repo, "number": &evt.Number, "state": &evt.State, "action": &evt.Action,
+			"action_detail": &evt.ActionDetail, "author": &evt.Author, "commenter": &evt.Commenter,
+			"comment_id": &evt.CommentID, "comment": &evt.Comment,
+		}
+		for k, v := range fields {
+			v := v
+			*ptrs[k] = &v
+		}
+		return evt
+	}
+
+	// the PR is created with one commit
+	bot.handlePullRequestEvent(event(map[string]string{"action": "open"}), cnf, bot.log)
+	assert.Empty(t, fake.PRLabels("owner2", "repo1", number))
+
+	// the author adds a label by the command, the feedback is a reaction
+	bot.handlePullRequestCommentEvent(event(map[string]string{
+		"commenter": "bob", "comment_id": "100", "comment": "/kind bug",
+	}), cnf, bot.log)
+	assert.Equal(t, []string{"kind/bug"}, fake.PRLabels("owner2", "repo1", number))
+	assert.Equal(t, []string{reactionSuccess}, fake.Reactions("owner2", "repo1", "100"))
+
+	// the PR is approved by a reviewer
+	pr.Labels = append(pr.Labels, "lgtm")
+
+	// the author pushes another commit, lgtm is cleared and the PR needs squashing
+	pr.Push(nil, client.PRCommit{AuthorName: "bob"})
+	bot.handlePullRequestEvent(event(map[string]string{
+		"action": "update", "action_detail": "source update", "author": "bob",
+	}), cnf, bot.log)
+	assert.Equal(t, []string{"kind/bug", "stat/needs-squash"}, fake.PRLabels("owner2", "repo1", number))
+	comments := fake.PRComments("owner2", "repo1", number)
+	assert.Equal(t, 1, len(comments))
+	assert.Equal(t, "removes the following label(s): lgtm.", comments[0].Body)
+
+	// a collaborator removes the label
+	bot.handlePullRequestCommentEvent(event(map[string]string{
+		"commenter": "alice", "comment_id": "101", "comment": "/remove-kind bug",
+	}), cnf, bot.log)
+	assert.Equal(t, []string{"stat/needs-squash"}, fake.PRLabels("owner2", "repo1", number))
+
+	// a conflicting command is reported without checking the permission and the labels of the repository
+	calls := len(fake.Calls())
+	bot.handlePullRequestCommentEvent(event(map[string]string{
+		"commenter": "alice", "comment_id": "102", "comment": "/kind bug\n/remove-kind bug",
+	}), cnf, bot.log)
+	for _, call := range fake.Calls()[calls:] {
+		assert.NotContains(t, []string{"CheckPermission", "GetRepoIssueLabels"}, call.Method)
+	}
+	assert.Equal(t, []string{reactionFailure}, fake.Reactions("owner2", "repo1", "102"))
+}
@@ -0,0 +1,163 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+var specificityNames = map[int]string{
+	specificityWildcard: "wildcard",
+	specificityOrg:      "org",
+	specificityRepo:     "repo",
+}
+
+// explainConfig prints the effective config of a repository resolved in the same way as the bot,
+// and which config items it is layered from. It returns the exit code.
+//
+//	robot-universal-label explain --config-file=config.yaml org/repo [branch]
+func explainConfig(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	fs.SetOutput(out)
+	configFile := fs.String("config-file", "", "Path to the config file.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	org, repo, ok := strings.Cut(fs.Arg(0), "/")
+	if *configFile == "" || !ok || org == "" || repo == "" || fs.NArg() > 2 {
+		_, _ = fmt.Fprintln(out, "usage: explain --config-file=config.yaml org/repo [branch]")
+		return 2
+	}
+
+	cnf, problems := loadConfigFile(*configFile)
+	if len(problems) != 0 {
+		_, _ = fmt.Fprintln(out, strings.Join(problems, "\n"))
+		return 1
+	}
+
+	_, _ = fmt.Fprint(out, cnf.explain(org, repo, fs.Arg(1)))
+	return 0
+}
+
+// explain describes the effective config of the repository
+func (c *configuration) explain(org, repo, branch string) string {
+	var b strings.Builder
+	line := func(format string, a ...any) {
+		_, _ = fmt.Fprintf(&b, format+"\n", a...)
+	}
+
+	line("repository: %s/%s", org, repo)
+	if branch != "" {
+		line("branch: %s (the config does not vary by branch)", branch)
+	}
+
+	matched := c.matchRepoConfigs(org, repo)
+	repoCnf := c.getRepoConfig(org, repo)
+	if repoCnf == nil {
+		line("matched config items: none, the bot ignores the events of the repository")
+		return b.String()
+	}
+
+	line("matched config items, from the least to the most specific:")
+	for _, i := range matched {
+		line("  config_items[%d] (%s)", i, specificityNames[c.ConfigItems[i].specificity(org, repo)])
+	}
+
+	clearRegexp := ""
+	if repoCnf.ClearLabelsRegexp != nil {
+		clearRegexp = repoCnf.ClearLabelsRegexp.String()
+	}
+	line("clear_labels: %s", strings.Join(repoCnf.ClearLabels, ", "))
+	line("clear_labels_by_regexp: %s", clearRegexp)
+	line("clear_labels_patterns: %s", joinPatterns(repoCnf.clearLabelsIncludes))
+	line("excluded_clear_labels_patterns: %s", joinPatterns(repoCnf.clearLabelsExcludes))
+	line("skip_clearing_on_rebase: %t", repoCnf.SkipClearingOnRebase)
+	for _, l := range sortedKeys(repoCnf.ClearLabelsPaths) {
+		line("clear_labels_paths: %s only when %s changed", l, strings.Join(repoCnf.ClearLabelsPaths[l], ", "))
+	}
+	line("squash_commit_label: %s", c.squashCommitLabel(repoCnf))
+	line("unable_checking_squash: %t", repoCnf.UnableCheckingSquash)
+	line("commits_threshold: %d", repoCnf.CommitsThreshold)
+	line("allow_creating_labels_by_collaborator: %t", repoCnf.AllowCreatingLabelsByCollaborator)
+	line("trusted_pushers: %s", strings.Join(repoCnf.TrustedPushers, ", "))
+	line("trust_collaborators: %t", repoCnf.TrustCollaborators)
+	line("feedback_mode: %s", repoCnf.FeedbackMode)
+	line("edit_previous_feedback: %t", repoCnf.EditPreviousFeedback)
+	line("dry_run: %t", repoCnf.DryRun)
+	line("platform: %s", repoCnf.platform())
+	line("credential: %s", repoCnf.Credential)
+	line("locales: %s", strings.Join(localesOf(repoCnf), ", "))
+
+	line("templates:")
+	for _, locale := range localesOf(repoCnf) {
+		for _, t := range c.explainTemplates(locale, matched) {
+			line("  %s", t)
+		}
+	}
+
+	return b.String()
+}
+
+// joinPatterns joins the compiled patterns, the globs are shown as the regexps they are compiled to
+func joinPatterns(patterns []*regexp.Regexp) string {
+	s := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		s = append(s, p.String())
+	}
+
+	return strings.Join(s, ", ")
+}
+
+// explainTemplates describes the templates of the locale and where each one comes from
+func (c *configuration) explainTemplates(locale string, matched []int) []string {
+	global := c.CommentTemplates
+	if locale != defaultLocale {
+		global = c.Locales[locale]
+	}
+
+	k := reflect.TypeOf(global)
+	n := k.NumField()
+	templates := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if k.Field(i).Tag.Get("template") == "" {
+			continue
+		}
+
+		name := strings.Split(k.Field(i).Tag.Get("json"), ",")[0]
+		text, from := reflect.ValueOf(global).Field(i).String(), "global"
+		if locale != defaultLocale {
+			from = "locales." + locale
+		} else {
+			// the overrides of the repositories only apply to the default locale
+			for _, j := range matched {
+				if s := reflect.ValueOf(c.ConfigItems[j].CommentTemplates).Field(i).String(); s != "" {
+					text, from = s, fmt.Sprintf("config_items[%d]", j)
+				}
+			}
+		}
+		if text == "" {
+			text, from = defaultTemplates[name], "built-in"
+		}
+
+		templates = append(templates, fmt.Sprintf("[%s] %s (%s): %q", locale, name, from, text))
+	}
+
+	return templates
+}
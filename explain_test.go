@@ -0,0 +1,51 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestExplainConfig(t *testing.T) {
+	file := findTestdata(t, "config3.yaml")
+
+	var out strings.Builder
+	assert.Equal(t, 0, explainConfig([]string{"--config-file=" + file, "owner1/repo1", "master"}, &out))
+	got := out.String()
+	assert.Contains(t, got, "branch: master (the config does not vary by branch)\n")
+	assert.Contains(t, got, "  config_items[0] (wildcard)\n  config_items[1] (org)\n  config_items[2] (repo)\n")
+	assert.Contains(t, got, "clear_labels: \nclear_labels_by_regexp: lgtm-\n")
+	assert.Contains(t, got, "commits_threshold: 3\n")
+	assert.Contains(t, got, "feedback_mode: reaction\n")
+	assert.Contains(t, got, "dry_run: false\n")
+	assert.Contains(t, got, "platform: gitcode\n")
+	assert.Contains(t, got, `[default] comment_command_trigger (config_items[2]): "{{.Commenter}}, please comment once again."`)
+	assert.Contains(t, got, `[default] user_mark_format (global): "@{{.Commenter}}"`)
+	assert.Contains(t, got, "[default] comment_command_report (built-in): ")
+
+	out.Reset()
+	assert.Equal(t, 0, explainConfig([]string{"--config-file=" + file, "owner9/repo1"}, &out))
+	assert.Equal(t, "repository: owner9/repo1\nmatched config items: none, the bot ignores the events of the repository\n",
+		out.String())
+
+	out.Reset()
+	assert.Equal(t, 1, explainConfig([]string{"--config-file=" + findTestdata(t, "config2.yaml"), "owner2/repo1"}, &out))
+	assert.Contains(t, out.String(), "excluded_repos[0]: owner2/repo1 exists in both repos and excluded_repos")
+
+	out.Reset()
+	assert.Equal(t, 2, explainConfig([]string{"--config-file=" + file, "owner1"}, &out))
+	assert.Equal(t, "usage: explain --config-file=config.yaml org/repo [branch]\n", out.String())
+}
@@ -0,0 +1,480 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fakeclient provides a stateful in-memory code hosting client, it models the repositories,
+// the labels, the pull requests, the issues, the commits, the permissions and the comments,
+// so that the whole scenarios of a robot can be tested without the real API, e.g.
+// a comment adds a label, then a push clears it.
+package fakeclient
+
+import (
+	"fmt"
+	"github.com/opensourceways/robot-framework-lib/client"
+	"github.com/opensourceways/robot-framework-lib/utils"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Call is a call to the client
+type Call struct {
+	Method string
+	Args   []any
+}
+
+func (c Call) String() string {
+	return fmt.Sprintf("%s%q", c.Method, c.Args)
+}
+
+// Client is the fake client, its zero value is not usable, create it by New.
+// It is safe for concurrent use.
+type Client struct {
+	lock     sync.Mutex
+	repos    map[string]*Repo
+	calls    []Call
+	failures map[string]bool
+	lastID   int
+}
+
+// Repo is a repository of the fake client, the fields are read and written under the lock of the client,
+// so they should only be set up before the client is used.
+type Repo struct {
+	// Labels are the labels of the repository
+	Labels []string
+	// Collaborators are the users who have the permission of the repository
+	Collaborators []string
+	PRs           map[string]*PullRequest
+	Issues        map[string]*Issue
+	// Reactions are the reactions to the comments keyed by the comment ids
+	Reactions map[string][]string
+}
+
+// PullRequest is a pull request of the fake client
+type PullRequest struct {
+	Labels  []string
+	Commits []client.PRCommit
+	Changes []client.CommitFile
+	// Comments are the comments created by the client, i.e. by the bot
+	Comments []client.PRComment
+}
+
+// Issue is an issue of the fake client
+type Issue struct {
+	// ID is the global id of the issue, which GetIssueLabels looks the issue up by
+	ID       string
+	Labels   []string
+	Comments []client.PRComment
+}
+
+// New creates a fake client without any repository
+func New() *Client {
+	return &Client{repos: make(map[string]*Repo), failures: make(map[string]bool)}
+}
+
+// AddRepo creates the repository with the labels, or returns it if it exists
+func (c *Client) AddRepo(org, repo string, labels ...string) *Repo {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if r, ok := c.repos[org+"/"+repo]; ok {
+		return r
+	}
+
+	r := &Repo{
+		Labels:    labels,
+		PRs:       make(map[string]*PullRequest),
+		Issues:    make(map[string]*Issue),
+		Reactions: make(map[string][]string),
+	}
+	c.repos[org+"/"+repo] = r
+
+	return r
+}
+
+// OpenPR creates the pull request with the commits
+func (r *Repo) OpenPR(number string, commits ...client.PRCommit) *PullRequest {
+	pr := &PullRequest{Commits: commits}
+	r.PRs[number] = pr
+
+	return pr
+}
+
+// OpenIssue creates the issue whose global id is id
+func (r *Repo) OpenIssue(number, id string) *Issue {
+	issue := &Issue{ID: id}
+	r.Issues[number] = issue
+
+	return issue
+}
+
+// Push appends the commits to the pull request, and replaces its changes with the changes after the push
+func (pr *PullRequest) Push(changes []client.CommitFile, commits ...client.PRCommit) {
+	pr.Commits = append(pr.Commits, commits...)
+	pr.Changes = changes
+}
+
+// Fail makes the calls of the methods fail, e.g. Fail("AddPRLabels"), until Recover is called
+func (c *Client) Fail(methods ...string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, m := range methods {
+		c.failures[m] = true
+	}
+}
+
+// Recover makes the calls of the methods succeed again
+func (c *Client) Recover(methods ...string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, m := range methods {
+		delete(c.failures, m)
+	}
+}
+
+// Calls returns the calls to the client in order
+func (c *Client) Calls() []Call {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return slices.Clone(c.calls)
+}
+
+// PRLabels returns the labels of the pull request, it is nil if the pull request does not exist
+func (c *Client) PRLabels(org, repo, number string) []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if pr := c.pr(org, repo, number); pr != nil {
+		return slices.Clone(pr.Labels)
+	}
+
+	return nil
+}
+
+// PRComments returns the comments of the pull request, it is nil if the pull request does not exist
+func (c *Client) PRComments(org, repo, number string) []client.PRComment {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if pr := c.pr(org, repo, number); pr != nil {
+		return slices.Clone(pr.Comments)
+	}
+
+	return nil
+}
+
+// IssueLabels returns the labels of the issue, it is nil if the issue does not exist
+func (c *Client) IssueLabels(org, repo, number string) []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if r := c.repos[org+"/"+repo]; r != nil && r.Issues[number] != nil {
+		return slices.Clone(r.Issues[number].Labels)
+	}
+
+	return nil
+}
+
+// Reactions returns the reactions to the comment of the repository
+func (c *Client) Reactions(org, repo, commentID string) []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if r := c.repos[org+"/"+repo]; r != nil {
+		return slices.Clone(r.Reactions[commentID])
+	}
+
+	return nil
+}
+
+// call records the call of the method, and returns false if the method is made to fail.
+// It must be called with the lock held.
+func (c *Client) call(method string, args ...any) bool {
+	c.calls = append(c.calls, Call{Method: method, Args: args})
+
+	return !c.failures[method]
+}
+
+func (c *Client) pr(org, repo, number string) *PullRequest {
+	if r := c.repos[org+"/"+repo]; r != nil {
+		return r.PRs[number]
+	}
+
+	return nil
+}
+
+func (c *Client) issue(org, repo, number string) *Issue {
+	if r := c.repos[org+"/"+repo]; r != nil {
+		return r.Issues[number]
+	}
+
+	return nil
+}
+
+func (c *Client) newComment(body string) client.PRComment {
+	c.lastID++
+	return client.PRComment{ID: strconv.Itoa(c.lastID), Body: body}
+}
+
+// addLabels adds the labels to the target, the labels missing in the repository are created as the API does
+func addLabels(r *Repo, target []string, labels []string) []string {
+	for _, l := range labels {
+		if !slices.Contains(r.Labels, l) {
+			r.Labels = append(r.Labels, l)
+		}
+		if !slices.Contains(target, l) {
+			target = append(target, l)
+		}
+	}
+
+	return target
+}
+
+// removeLabels removes the labels from the target, they are escaped in the url as the bot passes them
+func removeLabels(target []string, labels []string) []string {
+	return slices.DeleteFunc(target, func(l string) bool {
+		return slices.ContainsFunc(labels, func(escaped string) bool {
+			s, err := url.QueryUnescape(escaped)
+			return l == escaped || (err == nil && l == s)
+		})
+	})
+}
+
+func (c *Client) CreatePRComment(org, repo, number, comment string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	pr := c.pr(org, repo, number)
+	if !c.call("CreatePRComment", org, repo, number, comment) || pr == nil {
+		return false
+	}
+	pr.Comments = append(pr.Comments, c.newComment(comment))
+
+	return true
+}
+
+func (c *Client) CreateIssueComment(org, repo, number, comment string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	issue := c.issue(org, repo, number)
+	if !c.call("CreateIssueComment", org, repo, number, comment) || issue == nil {
+		return false
+	}
+	issue.Comments = append(issue.Comments, c.newComment(comment))
+
+	return true
+}
+
+func (c *Client) AddIssueLabels(org, repo, number string, labels []string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	issue := c.issue(org, repo, number)
+	if !c.call("AddIssueLabels", org, repo, number, labels) || issue == nil {
+		return false
+	}
+	issue.Labels = addLabels(c.repos[org+"/"+repo], issue.Labels, labels)
+
+	return true
+}
+
+func (c *Client) RemoveIssueLabels(org, repo, number string, labels []string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	issue := c.issue(org, repo, number)
+	if !c.call("RemoveIssueLabels", org, repo, number, labels) || issue == nil {
+		return false
+	}
+	issue.Labels = removeLabels(issue.Labels, labels)
+
+	return true
+}
+
+func (c *Client) AddPRLabels(org, repo, number string, labels []string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	pr := c.pr(org, repo, number)
+	if !c.call("AddPRLabels", org, repo, number, labels) || pr == nil {
+		return false
+	}
+	pr.Labels = addLabels(c.repos[org+"/"+repo], pr.Labels, labels)
+
+	return true
+}
+
+func (c *Client) RemovePRLabels(org, repo, number string, labels []string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	pr := c.pr(org, repo, number)
+	if !c.call("RemovePRLabels", org, repo, number, labels) || pr == nil {
+		return false
+	}
+	pr.Labels = removeLabels(pr.Labels, labels)
+
+	return true
+}
+
+// CheckIfPRCreateEvent checks the event in the same way as the GitCode client, it is not recorded as a call
+func (c *Client) CheckIfPRCreateEvent(evt *client.GenericEvent) bool {
+	return utils.GetString(evt.State) == "opened" && utils.GetString(evt.Action) == "open"
+}
+
+// CheckIfPRSourceCodeUpdateEvent checks the event in the same way as the GitCode client, it is not recorded as a call
+func (c *Client) CheckIfPRSourceCodeUpdateEvent(evt *client.GenericEvent) bool {
+	return utils.GetString(evt.State) == "opened" && utils.GetString(evt.Action) == "update" &&
+		utils.GetString(evt.ActionDetail) == "source update"
+}
+
+func (c *Client) GetPullRequestCommits(org, repo, number string) ([]client.PRCommit, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	pr := c.pr(org, repo, number)
+	if !c.call("GetPullRequestCommits", org, repo, number) || pr == nil {
+		return nil, false
+	}
+
+	return slices.Clone(pr.Commits), true
+}
+
+func (c *Client) GetPullRequestLabels(org, repo, number string) ([]string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	pr := c.pr(org, repo, number)
+	if !c.call("GetPullRequestLabels", org, repo, number) || pr == nil {
+		return nil, false
+	}
+
+	return slices.Clone(pr.Labels), true
+}
+
+// GetIssueLabels looks the issue up by the id, in the same way as GitCode
+func (c *Client) GetIssueLabels(org, repo, number, issueID string) ([]string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.call("GetIssueLabels", org, repo, number, issueID) {
+		return nil, false
+	}
+	for k, r := range c.repos {
+		if !strings.HasPrefix(k, org+"/") {
+			continue
+		}
+		for _, issue := range r.Issues {
+			if issue.ID == issueID {
+				return slices.Clone(issue.Labels), true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func (c *Client) GetRepoIssueLabels(org, repo string) ([]string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	r := c.repos[org+"/"+repo]
+	if !c.call("GetRepoIssueLabels", org, repo) || r == nil {
+		return nil, false
+	}
+
+	return slices.Clone(r.Labels), true
+}
+
+func (c *Client) CheckPermission(org, repo, username string) (bool, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	r := c.repos[org+"/"+repo]
+	if !c.call("CheckPermission", org, repo, username) || r == nil {
+		return false, false
+	}
+
+	return slices.Contains(r.Collaborators, username), true
+}
+
+func (c *Client) CreatePRCommentReaction(org, repo, commentID, reaction string) bool {
+	return c.react("CreatePRCommentReaction", org, repo, commentID, reaction)
+}
+
+func (c *Client) CreateIssueCommentReaction(org, repo, commentID, reaction string) bool {
+	return c.react("CreateIssueCommentReaction", org, repo, commentID, reaction)
+}
+
+func (c *Client) react(method, org, repo, commentID, reaction string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	r := c.repos[org+"/"+repo]
+	if !c.call(method, org, repo, commentID, reaction) || r == nil {
+		return false
+	}
+	r.Reactions[commentID] = append(r.Reactions[commentID], reaction)
+
+	return true
+}
+
+func (c *Client) ListBotPRComments(org, repo, number string) ([]client.PRComment, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	pr := c.pr(org, repo, number)
+	if !c.call("ListBotPRComments", org, repo, number) || pr == nil {
+		return nil, false
+	}
+
+	return slices.Clone(pr.Comments), true
+}
+
+func (c *Client) UpdatePRComment(org, repo, commentID, comment string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	r := c.repos[org+"/"+repo]
+	if !c.call("UpdatePRComment", org, repo, commentID, comment) || r == nil {
+		return false
+	}
+	for _, pr := range r.PRs {
+		for i := range pr.Comments {
+			if pr.Comments[i].ID == commentID {
+				pr.Comments[i].Body = comment
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (c *Client) GetPullRequestChanges(org, repo, number string) ([]client.CommitFile, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	pr := c.pr(org, repo, number)
+	if !c.call("GetPullRequestChanges", org, repo, number) || pr == nil {
+		return nil, false
+	}
+
+	return slices.Clone(pr.Changes), true
+}
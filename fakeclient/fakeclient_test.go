@@ -0,0 +1,65 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package fakeclient
+
+import (
+	"github.com/opensourceways/robot-framework-lib/client"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	c := New()
+	r := c.AddRepo("org", "repo", "kind/bug")
+	r.Collaborators = []string{"alice"}
+	r.OpenPR("1", client.PRCommit{AuthorName: "alice"})
+	r.OpenIssue("2", "I2")
+
+	assert.True(t, c.AddPRLabels("org", "repo", "1", []string{"kind/bug", "sig/doc"}))
+	// the missing labels are created
+	labels, ok := c.GetRepoIssueLabels("org", "repo")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"kind/bug", "sig/doc"}, labels)
+	// the labels to remove are escaped
+	assert.True(t, c.RemovePRLabels("org", "repo", "1", []string{url.QueryEscape("kind/bug")}))
+	assert.Equal(t, []string{"sig/doc"}, c.PRLabels("org", "repo", "1"))
+
+	assert.True(t, c.AddIssueLabels("org", "repo", "2", []string{"kind/bug"}))
+	labels, ok = c.GetIssueLabels("org", "repo", "2", "I2")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"kind/bug"}, labels)
+
+	assert.True(t, c.CreatePRComment("org", "repo", "1", "first"))
+	comments, _ := c.ListBotPRComments("org", "repo", "1")
+	assert.True(t, c.UpdatePRComment("org", "repo", comments[0].ID, "edited"))
+	assert.Equal(t, []client.PRComment{{ID: "1", Body: "edited"}}, c.PRComments("org", "repo", "1"))
+
+	pass, ok := c.CheckPermission("org", "repo", "bob")
+	assert.True(t, ok)
+	assert.False(t, pass)
+
+	// the unknown PRs and the failing methods fail
+	assert.False(t, c.AddPRLabels("org", "repo", "3", []string{"kind/bug"}))
+	c.Fail("GetPullRequestLabels")
+	_, ok = c.GetPullRequestLabels("org", "repo", "1")
+	assert.False(t, ok)
+	c.Recover("GetPullRequestLabels")
+	_, ok = c.GetPullRequestLabels("org", "repo", "1")
+	assert.True(t, ok)
+
+	calls := c.Calls()
+	assert.Equal(t, 12, len(calls))
+	assert.Equal(t, `AddPRLabels["org" "repo" "1" ["kind/bug" "sig/doc"]]`, calls[0].String())
+}
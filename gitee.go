@@ -0,0 +1,163 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"github.com/opensourceways/robot-framework-lib/client"
+	"github.com/opensourceways/robot-framework-lib/utils"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// giteeClient is the client of the Gitee API
+type giteeClient struct {
+	api *restClient
+	log *logrus.Entry
+}
+
+func newGiteeClient(token []byte, baseURL string, logger *logrus.Entry) *giteeClient {
+	if baseURL == "" {
+		baseURL = giteeAPIURL
+	}
+
+	return &giteeClient{api: newRestClient(baseURL, func(req *http.Request) error {
+		q := req.URL.Query()
+		q.Set("access_token", string(token))
+		req.URL.RawQuery = q.Encode()
+		return nil
+	}, logger), log: logger}
+}
+
+func (c *giteeClient) CreatePRComment(org, repo, number, comment string) bool {
+	return c.api.do(http.MethodPost, fmt.Sprintf("repos/%s/%s/pulls/%s/comments", org, repo, number),
+		map[string]string{"body": comment}, nil)
+}
+
+func (c *giteeClient) CreateIssueComment(org, repo, number, comment string) bool {
+	return c.api.do(http.MethodPost, fmt.Sprintf("repos/%s/%s/issues/%s/comments", org, repo, number),
+		map[string]string{"body": comment}, nil)
+}
+
+func (c *giteeClient) AddIssueLabels(org, repo, number string, labels []string) bool {
+	return c.api.do(http.MethodPost, fmt.Sprintf("repos/%s/%s/issues/%s/labels", org, repo, number), labels, nil)
+}
+
+func (c *giteeClient) RemoveIssueLabels(org, repo, number string, labels []string) bool {
+	return c.removeLabels(fmt.Sprintf("repos/%s/%s/issues/%s/labels/", org, repo, number), labels)
+}
+
+func (c *giteeClient) AddPRLabels(org, repo, number string, labels []string) bool {
+	return c.api.do(http.MethodPost, fmt.Sprintf("repos/%s/%s/pulls/%s/labels", org, repo, number), labels, nil)
+}
+
+func (c *giteeClient) RemovePRLabels(org, repo, number string, labels []string) bool {
+	return c.removeLabels(fmt.Sprintf("repos/%s/%s/pulls/%s/labels/", org, repo, number), labels)
+}
+
+// removeLabels removes the labels at once, they are separated by commas in the path
+func (c *giteeClient) removeLabels(path string, labels []string) bool {
+	names := unescapeLabels(labels)
+	for i := range names {
+		names[i] = url.PathEscape(names[i])
+	}
+
+	return c.api.do(http.MethodDelete, path+strings.Join(names, ","), nil, nil)
+}
+
+func (c *giteeClient) CheckIfPRCreateEvent(evt *client.GenericEvent) bool {
+	return utils.GetString(evt.State) == "open" && utils.GetString(evt.Action) == "open"
+}
+
+func (c *giteeClient) CheckIfPRSourceCodeUpdateEvent(evt *client.GenericEvent) bool {
+	return utils.GetString(evt.State) == "open" && utils.GetString(evt.Action) == "update" &&
+		utils.GetString(evt.ActionDetail) == "source_branch_changed"
+}
+
+func (c *giteeClient) GetPullRequestCommits(org, repo, number string) ([]client.PRCommit, bool) {
+	commits, success := listAll[restCommit](c.api, fmt.Sprintf("repos/%s/%s/pulls/%s/commits", org, repo, number))
+	return prCommits(commits), success
+}
+
+func (c *giteeClient) GetPullRequestLabels(org, repo, number string) ([]string, bool) {
+	labels, success := listAll[restLabel](c.api, fmt.Sprintf("repos/%s/%s/pulls/%s/labels", org, repo, number))
+	return labelNames(labels), success
+}
+
+func (c *giteeClient) GetIssueLabels(org, repo, number, issueID string) ([]string, bool) {
+	labels, success := listAll[restLabel](c.api, fmt.Sprintf("repos/%s/%s/issues/%s/labels", org, repo, number))
+	return labelNames(labels), success
+}
+
+func (c *giteeClient) GetRepoIssueLabels(org, repo string) ([]string, bool) {
+	labels, success := listAll[restLabel](c.api, fmt.Sprintf("repos/%s/%s/labels", org, repo))
+	return labelNames(labels), success
+}
+
+// CheckPermission passes the users who can write the repository
+func (c *giteeClient) CheckPermission(org, repo, username string) (bool, bool) {
+	var p struct {
+		Permission string `json:"permission"`
+	}
+	if !c.api.do(http.MethodGet, fmt.Sprintf("repos/%s/%s/collaborators/%s/permission", org, repo, username), nil, &p) {
+		return false, false
+	}
+
+	return p.Permission == "admin" || p.Permission == "write", true
+}
+
+// CreatePRCommentReaction fails, Gitee has no API of the reactions
+func (c *giteeClient) CreatePRCommentReaction(org, repo, commentID, reaction string) bool {
+	c.log.Warningf("the reactions are not supported by Gitee, %s/%s", org, repo)
+	return false
+}
+
+// CreateIssueCommentReaction fails, Gitee has no API of the reactions
+func (c *giteeClient) CreateIssueCommentReaction(org, repo, commentID, reaction string) bool {
+	c.log.Warningf("the reactions are not supported by Gitee, %s/%s", org, repo)
+	return false
+}
+
+func (c *giteeClient) ListBotPRComments(org, repo, number string) ([]client.PRComment, bool) {
+	return listUserComments(c.api, fmt.Sprintf("repos/%s/%s/pulls/%s/comments", org, repo, number))
+}
+
+func (c *giteeClient) UpdatePRComment(org, repo, commentID, comment string) bool {
+	return c.api.do(http.MethodPatch, fmt.Sprintf("repos/%s/%s/pulls/comments/%s", org, repo, commentID),
+		map[string]string{"body": comment}, nil)
+}
+
+func (c *giteeClient) GetPullRequestChanges(org, repo, number string) ([]client.CommitFile, bool) {
+	// the numbers of the additions and the deletions are strings on Gitee, they are not decoded
+	type file struct {
+		SHA      string              `json:"sha"`
+		Filename string              `json:"filename"`
+		Status   string              `json:"status"`
+		Patch    *client.CommitPatch `json:"patch"`
+	}
+	var files []file
+	if !c.api.do(http.MethodGet, fmt.Sprintf("repos/%s/%s/pulls/%s/files", org, repo, number), nil, &files) {
+		return nil, false
+	}
+
+	r := make([]client.CommitFile, len(files))
+	for i := range files {
+		f := &files[i]
+		r[i] = client.CommitFile{SHA: &f.SHA, Filename: &f.Filename, Status: &f.Status, Patch: f.Patch}
+	}
+
+	return r, true
+}
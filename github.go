@@ -0,0 +1,165 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"github.com/opensourceways/robot-framework-lib/client"
+	"github.com/opensourceways/robot-framework-lib/utils"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+)
+
+// githubClient is the client of the GitHub API, the pull requests are the issues with the labels and the comments
+type githubClient struct {
+	api *restClient
+	// appID is the id of the GitHub App whose installation token the client calls the API with,
+	// it is empty if the client calls the API with the token of a user
+	appID string
+}
+
+func newGitHubClient(token []byte, baseURL string, logger *logrus.Entry) *githubClient {
+	if baseURL == "" {
+		baseURL = githubAPIURL
+	}
+
+	return &githubClient{api: newRestClient(baseURL, func(req *http.Request) error {
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("Authorization", "Bearer "+string(token))
+		return nil
+	}, logger)}
+}
+
+func (c *githubClient) issuePath(org, repo, number string) string {
+	return fmt.Sprintf("repos/%s/%s/issues/%s", org, repo, number)
+}
+
+func (c *githubClient) CreatePRComment(org, repo, number, comment string) bool {
+	return c.CreateIssueComment(org, repo, number, comment)
+}
+
+func (c *githubClient) CreateIssueComment(org, repo, number, comment string) bool {
+	return c.api.do(http.MethodPost, c.issuePath(org, repo, number)+"/comments", map[string]string{"body": comment}, nil)
+}
+
+func (c *githubClient) AddIssueLabels(org, repo, number string, labels []string) bool {
+	return c.api.do(http.MethodPost, c.issuePath(org, repo, number)+"/labels", map[string][]string{"labels": labels}, nil)
+}
+
+func (c *githubClient) RemoveIssueLabels(org, repo, number string, labels []string) bool {
+	success := true
+	for _, l := range unescapeLabels(labels) {
+		success = c.api.do(http.MethodDelete, c.issuePath(org, repo, number)+"/labels/"+url.PathEscape(l), nil, nil) &&
+			success
+	}
+
+	return success
+}
+
+func (c *githubClient) AddPRLabels(org, repo, number string, labels []string) bool {
+	return c.AddIssueLabels(org, repo, number, labels)
+}
+
+func (c *githubClient) RemovePRLabels(org, repo, number string, labels []string) bool {
+	return c.RemoveIssueLabels(org, repo, number, labels)
+}
+
+func (c *githubClient) CheckIfPRCreateEvent(evt *client.GenericEvent) bool {
+	return utils.GetString(evt.Action) == "opened"
+}
+
+func (c *githubClient) CheckIfPRSourceCodeUpdateEvent(evt *client.GenericEvent) bool {
+	return utils.GetString(evt.Action) == "synchronize"
+}
+
+func (c *githubClient) GetPullRequestCommits(org, repo, number string) ([]client.PRCommit, bool) {
+	commits, success := listAll[restCommit](c.api, fmt.Sprintf("repos/%s/%s/pulls/%s/commits", org, repo, number))
+	return prCommits(commits), success
+}
+
+func (c *githubClient) GetPullRequestLabels(org, repo, number string) ([]string, bool) {
+	return c.GetIssueLabels(org, repo, number, "")
+}
+
+func (c *githubClient) GetIssueLabels(org, repo, number, issueID string) ([]string, bool) {
+	labels, success := listAll[restLabel](c.api, c.issuePath(org, repo, number)+"/labels")
+	return labelNames(labels), success
+}
+
+func (c *githubClient) GetRepoIssueLabels(org, repo string) ([]string, bool) {
+	labels, success := listAll[restLabel](c.api, fmt.Sprintf("repos/%s/%s/labels", org, repo))
+	return labelNames(labels), success
+}
+
+// CheckPermission passes the users who can write the repository, the maintainers included
+func (c *githubClient) CheckPermission(org, repo, username string) (bool, bool) {
+	var p struct {
+		Permission string `json:"permission"`
+	}
+	if !c.api.do(http.MethodGet, fmt.Sprintf("repos/%s/%s/collaborators/%s/permission", org, repo, username), nil, &p) {
+		return false, false
+	}
+
+	return p.Permission == "admin" || p.Permission == "write", true
+}
+
+func (c *githubClient) CreatePRCommentReaction(org, repo, commentID, reaction string) bool {
+	return c.CreateIssueCommentReaction(org, repo, commentID, reaction)
+}
+
+func (c *githubClient) CreateIssueCommentReaction(org, repo, commentID, reaction string) bool {
+	return c.api.do(http.MethodPost, fmt.Sprintf("repos/%s/%s/issues/comments/%s/reactions", org, repo, commentID),
+		map[string]string{"content": reaction}, nil)
+}
+
+func (c *githubClient) ListBotPRComments(org, repo, number string) ([]client.PRComment, bool) {
+	path := c.issuePath(org, repo, number) + "/comments"
+	if c.appID == "" {
+		return listUserComments(c.api, path)
+	}
+
+	// the installation token has no user, the comments are created by the app
+	comments, success := listAll[restComment](c.api, path)
+	return prComments(comments, func(cm *restComment) bool {
+		return cm.App != nil && (fmt.Sprint(cm.App.ID) == c.appID || cm.App.ClientID == c.appID)
+	}), success
+}
+
+func (c *githubClient) UpdatePRComment(org, repo, commentID, comment string) bool {
+	return c.api.do(http.MethodPatch, fmt.Sprintf("repos/%s/%s/issues/comments/%s", org, repo, commentID),
+		map[string]string{"body": comment}, nil)
+}
+
+func (c *githubClient) GetPullRequestChanges(org, repo, number string) ([]client.CommitFile, bool) {
+	type file struct {
+		SHA      string `json:"sha"`
+		Filename string `json:"filename"`
+		Status   string `json:"status"`
+		Patch    string `json:"patch"`
+	}
+	files, success := listAll[file](c.api, fmt.Sprintf("repos/%s/%s/pulls/%s/files", org, repo, number))
+
+	r := make([]client.CommitFile, len(files))
+	for i := range files {
+		f := &files[i]
+		r[i] = client.CommitFile{SHA: &f.SHA, Filename: &f.Filename, Status: &f.Status}
+		// the patch is absent if the diff is too large
+		if f.Patch != "" {
+			r[i].Patch = &client.CommitPatch{Diff: &f.Patch, NewPath: &f.Filename}
+		}
+	}
+
+	return r, success
+}
@@ -0,0 +1,362 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/opensourceways/robot-framework-lib/client"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// the modes of authenticating the bot
+const (
+	// authModeToken authenticates with the token of the token source
+	authModeToken = "token"
+	// authModeGitHubApp authenticates with the installation tokens of a GitHub App, one for each org
+	authModeGitHubApp = "github-app"
+)
+
+const (
+	githubAPIURL = "https://api.github.com/"
+	// the JWT of the app is valid for at most 10 minutes, it is backdated against the clock drift
+	appJWTLifetime = 9 * time.Minute
+	appJWTBackdate = time.Minute
+	// installationTokenRefreshBefore is how long before the expiry an installation token is minted again
+	installationTokenRefreshBefore = 5 * time.Minute
+)
+
+// githubApp mints the installation tokens of a GitHub App for the orgs,
+// the tokens are cached and minted again before they expire.
+type githubApp struct {
+	id  string
+	key *rsa.PrivateKey
+	api *restClient
+	now func() time.Time
+
+	lock sync.Mutex
+	// tokens are the installation tokens by org
+	tokens map[string]installationToken
+	// minting serializes the minting of the token of each org, the orgs do not wait for the minting of each other
+	minting map[string]*sync.Mutex
+}
+
+type installationToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func newGitHubApp(id, keyFile, baseURL string, logger *logrus.Entry) (*githubApp, error) {
+	if id == "" || keyFile == "" {
+		return nil, errors.New("missing the app id or the private key file of the GitHub App")
+	}
+	b, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parsePrivateKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key file %s: %w", keyFile, err)
+	}
+	if baseURL == "" {
+		baseURL = githubAPIURL
+	}
+
+	app := &githubApp{id: id, key: key, now: time.Now, tokens: map[string]installationToken{},
+		minting: map[string]*sync.Mutex{}}
+	// the app authenticates with the JWT, which expires in minutes
+	app.api = newRestClient(baseURL, func(req *http.Request) error {
+		jwt, err := app.jwt()
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("Authorization", "Bearer "+jwt)
+		return err
+	}, logger)
+
+	return app, nil
+}
+
+// parsePrivateKey parses the PEM encoded RSA private key, GitHub generates it in PKCS#1
+func parsePrivateKey(b []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an RSA private key")
+	}
+
+	return rsaKey, nil
+}
+
+// jwt returns the JSON Web Token signed by the private key, which authenticates as the app
+func (a *githubApp) jwt() (string, error) {
+	now := a.now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iat": now.Add(-appJWTBackdate).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": a.id,
+	})
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+// installationID returns the id of the installation of the app on the org, or on the user account
+func (a *githubApp) installationID(org string) (int64, error) {
+	var installation struct {
+		ID int64 `json:"id"`
+	}
+	status, err := a.api.call(http.MethodGet, "orgs/"+org+"/installation", nil, &installation)
+	if status == http.StatusNotFound {
+		_, err = a.api.call(http.MethodGet, "users/"+org+"/installation", nil, &installation)
+	}
+
+	return installation.ID, err
+}
+
+// cached returns the installation token of the org if it does not expire soon
+func (a *githubApp) cached(org string) ([]byte, bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if t, ok := a.tokens[org]; ok && a.now().Add(installationTokenRefreshBefore).Before(t.ExpiresAt) {
+		return []byte(t.Token), true
+	}
+
+	return nil, false
+}
+
+// mintingLock returns the lock which serializes the minting of the token of the org
+func (a *githubApp) mintingLock(org string) *sync.Mutex {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	m, ok := a.minting[org]
+	if !ok {
+		m = &sync.Mutex{}
+		a.minting[org] = m
+	}
+
+	return m
+}
+
+// token returns the installation token of the org, it is minted if there is none or it expires soon.
+// The API is called without holding the lock of the tokens, so that the cached tokens are not blocked by it.
+func (a *githubApp) token(org string) ([]byte, error) {
+	if token, ok := a.cached(org); ok {
+		return token, nil
+	}
+
+	m := a.mintingLock(org)
+	m.Lock()
+	defer m.Unlock()
+
+	// the token may be minted while waiting for the lock
+	if token, ok := a.cached(org); ok {
+		return token, nil
+	}
+
+	id, err := a.installationID(org)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the installation of the GitHub App on %s: %w", org, err)
+	}
+
+	var t installationToken
+	if _, err = a.api.call(http.MethodPost, fmt.Sprintf("app/installations/%d/access_tokens", id), nil, &t); err != nil {
+		return nil, fmt.Errorf("failed to mint the installation token of %s: %w", org, err)
+	}
+	if t.Token == "" {
+		return nil, errors.New("the installation token of " + org + " is empty")
+	}
+
+	a.lock.Lock()
+	a.tokens[org] = t
+	a.lock.Unlock()
+
+	return []byte(t.Token), nil
+}
+
+// appClient delegates the calls of an org to the client of the installation token of the org,
+// the client is replaced when the token is minted again. The installation tokens are GitHub tokens,
+// so clientOf creates the GitHub clients of the orgs whatever the platforms of the config items are.
+type appClient struct {
+	app      *githubApp
+	clientOf func(org string, token []byte) iClient
+	log      *logrus.Entry
+
+	lock    sync.Mutex
+	clients map[string]appOrgClient
+}
+
+type appOrgClient struct {
+	token string
+	cli   iClient
+}
+
+func newAppClient(app *githubApp, clientOf func(org string, token []byte) iClient, log *logrus.Entry) *appClient {
+	return &appClient{app: app, clientOf: clientOf, log: log, clients: map[string]appOrgClient{}}
+}
+
+// of returns the client of the org, it returns false if the installation token can not be minted
+func (c *appClient) of(org string) (iClient, bool) {
+	token, err := c.app.token(org)
+	if err != nil {
+		c.log.WithError(err).Errorf("failed to get the installation token of %s", org)
+		return nil, false
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	oc, ok := c.clients[org]
+	if !ok || oc.token != string(token) {
+		oc = appOrgClient{token: string(token), cli: c.clientOf(org, token)}
+		c.clients[org] = oc
+	}
+
+	return oc.cli, true
+}
+
+func (c *appClient) CreatePRComment(org, repo, number, comment string) bool {
+	cli, ok := c.of(org)
+	return ok && cli.CreatePRComment(org, repo, number, comment)
+}
+
+func (c *appClient) CreateIssueComment(org, repo, number, comment string) bool {
+	cli, ok := c.of(org)
+	return ok && cli.CreateIssueComment(org, repo, number, comment)
+}
+
+func (c *appClient) AddIssueLabels(org, repo, number string, labels []string) bool {
+	cli, ok := c.of(org)
+	return ok && cli.AddIssueLabels(org, repo, number, labels)
+}
+
+func (c *appClient) RemoveIssueLabels(org, repo, number string, labels []string) bool {
+	cli, ok := c.of(org)
+	return ok && cli.RemoveIssueLabels(org, repo, number, labels)
+}
+
+func (c *appClient) AddPRLabels(org, repo, number string, labels []string) bool {
+	cli, ok := c.of(org)
+	return ok && cli.AddPRLabels(org, repo, number, labels)
+}
+
+func (c *appClient) RemovePRLabels(org, repo, number string, labels []string) bool {
+	cli, ok := c.of(org)
+	return ok && cli.RemovePRLabels(org, repo, number, labels)
+}
+
+// CheckIfPRCreateEvent checks the event in the same way as the GitHub client, it needs no token
+func (c *appClient) CheckIfPRCreateEvent(evt *client.GenericEvent) bool {
+	return (&githubClient{}).CheckIfPRCreateEvent(evt)
+}
+
+// CheckIfPRSourceCodeUpdateEvent checks the event in the same way as the GitHub client, it needs no token
+func (c *appClient) CheckIfPRSourceCodeUpdateEvent(evt *client.GenericEvent) bool {
+	return (&githubClient{}).CheckIfPRSourceCodeUpdateEvent(evt)
+}
+
+func (c *appClient) GetPullRequestCommits(org, repo, number string) ([]client.PRCommit, bool) {
+	if cli, ok := c.of(org); ok {
+		return cli.GetPullRequestCommits(org, repo, number)
+	}
+	return nil, false
+}
+
+func (c *appClient) GetPullRequestLabels(org, repo, number string) ([]string, bool) {
+	if cli, ok := c.of(org); ok {
+		return cli.GetPullRequestLabels(org, repo, number)
+	}
+	return nil, false
+}
+
+func (c *appClient) GetIssueLabels(org, repo, number, issueID string) ([]string, bool) {
+	if cli, ok := c.of(org); ok {
+		return cli.GetIssueLabels(org, repo, number, issueID)
+	}
+	return nil, false
+}
+
+func (c *appClient) GetRepoIssueLabels(org, repo string) ([]string, bool) {
+	if cli, ok := c.of(org); ok {
+		return cli.GetRepoIssueLabels(org, repo)
+	}
+	return nil, false
+}
+
+func (c *appClient) CheckPermission(org, repo, username string) (bool, bool) {
+	if cli, ok := c.of(org); ok {
+		return cli.CheckPermission(org, repo, username)
+	}
+	return false, false
+}
+
+func (c *appClient) CreatePRCommentReaction(org, repo, commentID, reaction string) bool {
+	cli, ok := c.of(org)
+	return ok && cli.CreatePRCommentReaction(org, repo, commentID, reaction)
+}
+
+func (c *appClient) CreateIssueCommentReaction(org, repo, commentID, reaction string) bool {
+	cli, ok := c.of(org)
+	return ok && cli.CreateIssueCommentReaction(org, repo, commentID, reaction)
+}
+
+func (c *appClient) ListBotPRComments(org, repo, number string) ([]client.PRComment, bool) {
+	if cli, ok := c.of(org); ok {
+		return cli.ListBotPRComments(org, repo, number)
+	}
+	return nil, false
+}
+
+func (c *appClient) UpdatePRComment(org, repo, commentID, comment string) bool {
+	cli, ok := c.of(org)
+	return ok && cli.UpdatePRComment(org, repo, commentID, comment)
+}
+
+func (c *appClient) GetPullRequestChanges(org, repo, number string) ([]client.CommitFile, bool) {
+	if cli, ok := c.of(org); ok {
+		return cli.GetPullRequestChanges(org, repo, number)
+	}
+	return nil, false
+}
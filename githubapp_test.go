@@ -0,0 +1,141 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/opensourceways/robot-framework-lib/client"
+	"github.com/opensourceways/robot-framework-lib/framework"
+	"github.com/opensourceways/robot-universal-label/fakeclient"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGitHubApp(t *testing.T) {
+	opened := "opened"
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	keyFile := filepath.Join(t.TempDir(), "app.pem")
+	assert.Nil(t, os.WriteFile(keyFile,
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0o600))
+
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	minted := 0
+	blocked, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the JWT is signed by the private key of the app
+		parts := strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), ".")
+		assert.Equal(t, 3, len(parts))
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		assert.Nil(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig))
+		claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		assert.Contains(t, string(claims), `"iss":"1234"`)
+
+		switch r.URL.Path {
+		case "/orgs/slow/installation":
+			// the minting of the token of the org is blocked until released
+			blocked <- struct{}{}
+			<-release
+			w.WriteHeader(http.StatusNotFound)
+		case "/orgs/owner/installation":
+			_, _ = w.Write([]byte(`{"id": 7}`))
+		case "/orgs/user/installation":
+			w.WriteHeader(http.StatusNotFound)
+		case "/users/user/installation":
+			_, _ = w.Write([]byte(`{"id": 8}`))
+		case "/app/installations/7/access_tokens", "/app/installations/8/access_tokens":
+			assert.Equal(t, http.MethodPost, r.Method)
+			minted++
+			_ = json.NewEncoder(w).Encode(installationToken{
+				Token: fmt.Sprintf("token%d", minted), ExpiresAt: now.Add(time.Hour),
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	app, err := newGitHubApp("1234", keyFile, srv.URL, framework.NewLogger())
+	assert.Nil(t, err)
+	app.now = func() time.Time { return now }
+
+	clients := map[string]*fakeclient.Client{}
+	orgs := map[string]string{}
+	cli := newAppClient(app, func(org string, token []byte) iClient {
+		orgs[string(token)] = org
+		c := fakeclient.New()
+		c.AddRepo("owner", "repo1")
+		c.AddRepo("user", "repo1")
+		clients[string(token)] = c
+		return c
+	}, framework.NewLogger())
+
+	// the tokens are minted for each org and cached
+	cli.GetRepoIssueLabels("owner", "repo1")
+	cli.GetRepoIssueLabels("user", "repo1")
+	cli.GetRepoIssueLabels("owner", "repo1")
+	assert.Equal(t, 2, minted)
+	assert.Equal(t, 2, len(clients["token1"].Calls()))
+	assert.Equal(t, 1, len(clients["token2"].Calls()))
+
+	// the token is minted again before it expires
+	now = now.Add(56 * time.Minute)
+	cli.GetRepoIssueLabels("owner", "repo1")
+	assert.Equal(t, 3, minted)
+	assert.Equal(t, 1, len(clients["token3"].Calls()))
+	// the client of the token minted again is of the same org, so it has the same budget
+	assert.Equal(t, map[string]string{"token1": "owner", "token2": "user", "token3": "owner"}, orgs)
+
+	// the app is not installed on the org
+	_, ok := cli.GetRepoIssueLabels("nobody", "repo1")
+	assert.False(t, ok)
+
+	// the other orgs do not wait for the minting of an org
+	done := make(chan bool)
+	go func() {
+		_, ok := cli.GetRepoIssueLabels("slow", "repo1")
+		done <- ok
+	}()
+	<-blocked
+	_, ok = cli.GetRepoIssueLabels("owner", "repo1")
+	assert.True(t, ok)
+	close(release)
+	assert.False(t, <-done)
+
+	// the events are checked without the token
+	assert.True(t, cli.CheckIfPRCreateEvent(&client.GenericEvent{Action: &opened}))
+	assert.Equal(t, 3, minted)
+	assert.False(t, cli.AddPRLabels("nobody", "repo1", "1", []string{"kind/bug"}))
+
+	_, err = newGitHubApp("1234", "", srv.URL, framework.NewLogger())
+	assert.EqualError(t, err, "missing the app id or the private key file of the GitHub App")
+	assert.Nil(t, os.WriteFile(keyFile, []byte("key"), 0o600))
+	_, err = newGitHubApp("1234", keyFile, srv.URL, framework.NewLogger())
+	assert.ErrorContains(t, err, "no PEM data")
+}
@@ -0,0 +1,277 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"github.com/opensourceways/robot-framework-lib/client"
+	"github.com/opensourceways/robot-framework-lib/utils"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// the access level of the developers of the GitLab projects, who can push to the projects
+const gitlabDeveloperAccess = 30
+
+// gitlabKnownNotes bounds the notes whose merge requests are remembered, a note is updated right after
+// it is listed, so only the recent ones are needed
+const gitlabKnownNotes = 1024
+
+// gitlabClient is the client of the GitLab API, the pull requests are the merge requests.
+// The notes of the merge requests are addressed by the merge request, so the client remembers
+// the merge requests of the notes it listed, which UpdatePRComment looks up.
+type gitlabClient struct {
+	api *restClient
+	log *logrus.Entry
+
+	lock sync.Mutex
+	// mergeRequests are the numbers of the merge requests by the ids of the notes,
+	// notes are the ids in the order they are remembered, the oldest ones are forgotten first
+	mergeRequests map[string]string
+	notes         []string
+}
+
+func newGitLabClient(token []byte, baseURL string, logger *logrus.Entry) *gitlabClient {
+	if baseURL == "" {
+		baseURL = gitlabAPIURL
+	}
+
+	return &gitlabClient{api: newRestClient(baseURL, func(req *http.Request) error {
+		req.Header.Set("PRIVATE-TOKEN", string(token))
+		return nil
+	}, logger), log: logger, mergeRequests: map[string]string{}}
+}
+
+// path returns the path of the merge request or the issue, kind is merge_requests or issues
+func (c *gitlabClient) path(org, repo, kind, number string) string {
+	return fmt.Sprintf("projects/%s/%s/%s", url.PathEscape(org+"/"+repo), kind, number)
+}
+
+func (c *gitlabClient) CreatePRComment(org, repo, number, comment string) bool {
+	return c.api.do(http.MethodPost, c.path(org, repo, "merge_requests", number)+"/notes",
+		map[string]string{"body": comment}, nil)
+}
+
+func (c *gitlabClient) CreateIssueComment(org, repo, number, comment string) bool {
+	return c.api.do(http.MethodPost, c.path(org, repo, "issues", number)+"/notes",
+		map[string]string{"body": comment}, nil)
+}
+
+func (c *gitlabClient) AddIssueLabels(org, repo, number string, labels []string) bool {
+	return c.api.do(http.MethodPut, c.path(org, repo, "issues", number),
+		map[string]string{"add_labels": strings.Join(labels, ",")}, nil)
+}
+
+func (c *gitlabClient) RemoveIssueLabels(org, repo, number string, labels []string) bool {
+	return c.api.do(http.MethodPut, c.path(org, repo, "issues", number),
+		map[string]string{"remove_labels": strings.Join(unescapeLabels(labels), ",")}, nil)
+}
+
+func (c *gitlabClient) AddPRLabels(org, repo, number string, labels []string) bool {
+	return c.api.do(http.MethodPut, c.path(org, repo, "merge_requests", number),
+		map[string]string{"add_labels": strings.Join(labels, ",")}, nil)
+}
+
+func (c *gitlabClient) RemovePRLabels(org, repo, number string, labels []string) bool {
+	return c.api.do(http.MethodPut, c.path(org, repo, "merge_requests", number),
+		map[string]string{"remove_labels": strings.Join(unescapeLabels(labels), ",")}, nil)
+}
+
+// CheckIfPRCreateEvent checks the event in the same way as GitCode, whose webhooks are in the format of GitLab
+func (c *gitlabClient) CheckIfPRCreateEvent(evt *client.GenericEvent) bool {
+	return utils.GetString(evt.State) == "opened" && utils.GetString(evt.Action) == "open"
+}
+
+// CheckIfPRSourceCodeUpdateEvent checks the event in the same way as GitCode, whose webhooks are in the format of GitLab
+func (c *gitlabClient) CheckIfPRSourceCodeUpdateEvent(evt *client.GenericEvent) bool {
+	return utils.GetString(evt.State) == "opened" && utils.GetString(evt.Action) == "update" &&
+		utils.GetString(evt.ActionDetail) == "source update"
+}
+
+func (c *gitlabClient) GetPullRequestCommits(org, repo, number string) ([]client.PRCommit, bool) {
+	type commit struct {
+		AuthorName     string `json:"author_name"`
+		AuthorEmail    string `json:"author_email"`
+		CommitterName  string `json:"committer_name"`
+		CommitterEmail string `json:"committer_email"`
+	}
+	commits, success := listAll[commit](c.api, c.path(org, repo, "merge_requests", number)+"/commits")
+
+	r := make([]client.PRCommit, len(commits))
+	for i := range commits {
+		r[i] = client.PRCommit(commits[i])
+	}
+
+	return r, success
+}
+
+func (c *gitlabClient) labels(path string) ([]string, bool) {
+	var v struct {
+		Labels []string `json:"labels"`
+	}
+	success := c.api.do(http.MethodGet, path, nil, &v)
+
+	return v.Labels, success
+}
+
+func (c *gitlabClient) GetPullRequestLabels(org, repo, number string) ([]string, bool) {
+	return c.labels(c.path(org, repo, "merge_requests", number))
+}
+
+func (c *gitlabClient) GetIssueLabels(org, repo, number, issueID string) ([]string, bool) {
+	return c.labels(c.path(org, repo, "issues", number))
+}
+
+func (c *gitlabClient) GetRepoIssueLabels(org, repo string) ([]string, bool) {
+	labels, success := listAll[restLabel](c.api, fmt.Sprintf("projects/%s/labels", url.PathEscape(org+"/"+repo)))
+	return labelNames(labels), success
+}
+
+// CheckPermission passes the members who are developers or above, including the inherited ones
+func (c *gitlabClient) CheckPermission(org, repo, username string) (bool, bool) {
+	var users []struct {
+		ID int64 `json:"id"`
+	}
+	if !c.api.do(http.MethodGet, "users?username="+url.QueryEscape(username), nil, &users) {
+		return false, false
+	}
+	if len(users) == 0 {
+		return false, true
+	}
+
+	var member struct {
+		AccessLevel int `json:"access_level"`
+	}
+	status, err := c.api.call(http.MethodGet,
+		fmt.Sprintf("projects/%s/members/all/%d", url.PathEscape(org+"/"+repo), users[0].ID), nil, &member)
+	if status == http.StatusNotFound {
+		return false, true
+	}
+	if err != nil {
+		c.log.WithError(err).Error("failed to call the API")
+		return false, false
+	}
+
+	return member.AccessLevel >= gitlabDeveloperAccess, true
+}
+
+// CreatePRCommentReaction fails, the award emojis of the notes are addressed by the merge request
+func (c *gitlabClient) CreatePRCommentReaction(org, repo, commentID, reaction string) bool {
+	c.log.Warningf("the reactions to the comments are not supported by GitLab, %s/%s", org, repo)
+	return false
+}
+
+// CreateIssueCommentReaction fails, the award emojis of the notes are addressed by the issue
+func (c *gitlabClient) CreateIssueCommentReaction(org, repo, commentID, reaction string) bool {
+	c.log.Warningf("the reactions to the comments are not supported by GitLab, %s/%s", org, repo)
+	return false
+}
+
+func (c *gitlabClient) ListBotPRComments(org, repo, number string) ([]client.PRComment, bool) {
+	type note struct {
+		ID     int64    `json:"id"`
+		Body   string   `json:"body"`
+		System bool     `json:"system"`
+		Author restUser `json:"author"`
+	}
+	login, ok := c.api.user()
+	if !ok {
+		return nil, false
+	}
+	notes, success := listAll[note](c.api, c.path(org, repo, "merge_requests", number)+"/notes")
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var r []client.PRComment
+	for i := range notes {
+		// the system notes are the activities, e.g. the labels are added
+		if notes[i].System || notes[i].Author.name() != login {
+			continue
+		}
+		id := fmt.Sprint(notes[i].ID)
+		c.rememberNote(id, number)
+		r = append(r, client.PRComment{ID: id, Body: notes[i].Body})
+	}
+
+	return r, success
+}
+
+// rememberNote remembers the merge request of the note, the oldest note is forgotten beyond gitlabKnownNotes
+func (c *gitlabClient) rememberNote(id, number string) {
+	if _, ok := c.mergeRequests[id]; !ok {
+		c.notes = append(c.notes, id)
+		if len(c.notes) > gitlabKnownNotes {
+			delete(c.mergeRequests, c.notes[0])
+			c.notes = c.notes[1:]
+		}
+	}
+	c.mergeRequests[id] = number
+}
+
+// UpdatePRComment edits the note listed by ListBotPRComments, it fails if the merge request of the note is unknown
+func (c *gitlabClient) UpdatePRComment(org, repo, commentID, comment string) bool {
+	c.lock.Lock()
+	number, ok := c.mergeRequests[commentID]
+	c.lock.Unlock()
+	if !ok {
+		c.log.Warningf("the merge request of the note %s of %s/%s is unknown", commentID, org, repo)
+		return false
+	}
+
+	return c.api.do(http.MethodPut, c.path(org, repo, "merge_requests", number)+"/notes/"+commentID,
+		map[string]string{"body": comment}, nil)
+}
+
+func (c *gitlabClient) GetPullRequestChanges(org, repo, number string) ([]client.CommitFile, bool) {
+	type diff struct {
+		OldPath     string `json:"old_path"`
+		NewPath     string `json:"new_path"`
+		Diff        string `json:"diff"`
+		NewFile     bool   `json:"new_file"`
+		RenamedFile bool   `json:"renamed_file"`
+		DeletedFile bool   `json:"deleted_file"`
+	}
+	diffs, success := listAll[diff](c.api, c.path(org, repo, "merge_requests", number)+"/diffs")
+
+	r := make([]client.CommitFile, len(diffs))
+	for i := range diffs {
+		d := &diffs[i]
+		status := "modified"
+		switch {
+		case d.NewFile:
+			status = "added"
+		case d.DeletedFile:
+			status = "removed"
+		case d.RenamedFile:
+			status = "renamed"
+		}
+		r[i] = client.CommitFile{
+			Filename: &d.NewPath,
+			Status:   &status,
+			Patch: &client.CommitPatch{
+				Diff: &d.Diff, OldPath: &d.OldPath, NewPath: &d.NewPath,
+				NewFile: &d.NewFile, RenamedFile: &d.RenamedFile, DeletedFile: &d.DeletedFile,
+			},
+		}
+		if d.RenamedFile {
+			r[i].PreviousFilename = &d.OldPath
+		}
+	}
+
+	return r, success
+}
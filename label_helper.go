@@ -62,9 +62,9 @@ func matchLabelFromCommentLine(oneLineComment string, reg *regexp.Regexp) string
 	return label
 }
 
-func checkIntersection(add, remove []string) (bool, string) {
+func checkIntersection(add, remove []string) (bool, []string) {
 	if len(add) == 0 || len(remove) == 0 {
-		return false, ""
+		return false, nil
 	}
 
 	addSet, removeSet := sets.Set[string]{}, sets.Set[string]{}
@@ -78,8 +78,47 @@ func checkIntersection(add, remove []string) (bool, string) {
 	list := addSet.Intersection(removeSet).UnsortedList()
 	slices.Sort(list)
 	if len(list) == 0 {
-		return false, ""
+		return false, nil
 	}
 
-	return true, strings.Join(list, "**, **")
+	return true, list
+}
+
+const (
+	patternSyntaxRegexp = "regexp"
+	patternSyntaxGlob   = "glob"
+)
+
+// compilePattern compiles a label pattern in the syntax. In glob syntax, the pattern matches the whole label,
+// * matches any characters including /, ? matches one character, and the others match themselves.
+func compilePattern(pattern, syntax string) (*regexp.Regexp, error) {
+	if syntax != patternSyntaxGlob {
+		return regexp.Compile(pattern)
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+
+	return regexp.Compile(b.String())
+}
+
+func matchAnyPattern(label string, patterns []*regexp.Regexp) bool {
+	for _, p := range patterns {
+		if p.MatchString(label) {
+			return true
+		}
+	}
+
+	return false
 }
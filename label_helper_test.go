@@ -188,7 +188,7 @@ func TestMatchLabels(t *testing.T) {
 func TestCheckIntersection(t *testing.T) {
 	type result struct {
 		b bool
-		s string
+		s []string
 	}
 
 	testCases := []struct {
@@ -199,32 +199,32 @@ func TestCheckIntersection(t *testing.T) {
 		{
 			"add 1 label",
 			[2][]string{{testConstLabelKindTask}, nil},
-			result{false, ""},
+			result{false, nil},
 		},
 		{
 			"add 2 label",
 			[2][]string{{testConstLabelKindBug, testConstLabelPriorityLow}, nil},
-			result{false, ""},
+			result{false, nil},
 		},
 		{
 			"remove 2 label",
 			[2][]string{nil, {testConstLabelKindBug, testConstLabelPriorityLow}},
-			result{false, ""},
+			result{false, nil},
 		},
 		{
 			"add 1 label, remove 1 label",
 			[2][]string{{testConstLabelKindBug}, {testConstLabelKindTask}},
-			result{false, ""},
+			result{false, nil},
 		},
 		{
 			"add 1 label, remove 1 label",
 			[2][]string{{testConstLabelKindTask}, {testConstLabelKindTask}},
-			result{true, testConstLabelKindTask},
+			result{true, []string{testConstLabelKindTask}},
 		},
 		{
 			"add 2 label, remove 2 label",
 			[2][]string{{testConstLabelKindTask, "kind/CVE"}, {testConstLabelKindTask, "kind/cve"}},
-			result{true, "kind/cve**, **kind/task"},
+			result{true, []string{"kind/cve", "kind/task"}},
 		},
 	}
 	for i := range testCases {
@@ -235,3 +235,30 @@ func TestCheckIntersection(t *testing.T) {
 		})
 	}
 }
+
+func TestCompilePattern(t *testing.T) {
+	testCases := []struct {
+		pattern, syntax string
+		matched         []string
+		unmatched       []string
+	}{
+		{"^lgtm", patternSyntaxRegexp, []string{"lgtm", "lgtm-docs"}, []string{"no-lgtm"}},
+		{"lgtm*", patternSyntaxGlob, []string{"lgtm", "lgtm-docs"}, []string{"no-lgtm"}},
+		{"*/lgtm", patternSyntaxGlob, []string{"sig/lgtm", "a/b/lgtm"}, []string{"lgtm", "sig/lgtm-docs"}},
+		{"ci_??", patternSyntaxGlob, []string{"ci_ok"}, []string{"ci_successful"}},
+		{"a.b+", patternSyntaxGlob, []string{"a.b+"}, []string{"axbb"}},
+	}
+	for i := range testCases {
+		r, err := compilePattern(testCases[i].pattern, testCases[i].syntax)
+		assert.Nil(t, err)
+		for _, s := range testCases[i].matched {
+			assert.Equal(t, true, r.MatchString(s), testCases[i].pattern+" "+s)
+		}
+		for _, s := range testCases[i].unmatched {
+			assert.Equal(t, false, r.MatchString(s), testCases[i].pattern+" "+s)
+		}
+	}
+
+	_, err := compilePattern("lgtm-(", patternSyntaxRegexp)
+	assert.NotNil(t, err)
+}
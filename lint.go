@@ -0,0 +1,148 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/opensourceways/server-common-lib/utils"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// lintConfig checks the config files given by args in the same way as the startup of the server,
+// and prints all the problems with the line numbers. It needs no token, and returns the exit code,
+// which is 1 if any file has problems.
+//
+//	robot-universal-label lint [--config-file=config.yaml] [config.yaml ...]
+func lintConfig(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	fs.SetOutput(out)
+	configFile := fs.String("config-file", "", "Path to the config file.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	files := fs.Args()
+	if *configFile != "" {
+		files = append([]string{*configFile}, files...)
+	}
+	if len(files) == 0 {
+		_, _ = fmt.Fprintln(out, "no config file to lint")
+		return 2
+	}
+
+	code := 0
+	for _, file := range files {
+		problems := lintConfigFile(file)
+		for _, p := range problems {
+			_, _ = fmt.Fprintln(out, p)
+		}
+		if len(problems) != 0 {
+			code = 1
+		}
+	}
+
+	return code
+}
+
+// lintConfigFile returns the problems of the config file, each one is prefixed with the file and the line number.
+func lintConfigFile(file string) []string {
+	_, problems := loadConfigFile(file)
+	return problems
+}
+
+// loadConfigFile loads and validates the config file in the same way as the startup of the server,
+// it returns the problems of the file if it is invalid.
+func loadConfigFile(file string) (*configuration, []string) {
+	cnf := &configuration{}
+	if err := utils.LoadFromYaml(file, cnf); err != nil {
+		return nil, []string{file + ": " + err.Error()}
+	}
+
+	err := cnf.Validate()
+	if err == nil {
+		return cnf, nil
+	}
+
+	var root *yaml.Node
+	if b, e := os.ReadFile(file); e == nil {
+		root = new(yaml.Node)
+		if yaml.Unmarshal([]byte(os.ExpandEnv(string(b))), root) != nil {
+			root = nil
+		}
+	}
+
+	errs := unjoin(err)
+	problems := make([]string, 0, len(errs))
+	for _, e := range errs {
+		var ce *configError
+		if root != nil && errors.As(e, &ce) {
+			if line := lineOf(root, ce.path); line > 0 {
+				problems = append(problems, file+":"+strconv.Itoa(line)+": "+e.Error())
+				continue
+			}
+		}
+		problems = append(problems, file+": "+e.Error())
+	}
+
+	return nil, problems
+}
+
+// pathSegment matches a segment of the path of configError, e.g. config_items, [0], .repos
+var pathSegment = regexp.MustCompile(`\[(\d+)\]|\.?([^.\[]+)`)
+
+// lineOf returns the line of the field located by path in the yaml document,
+// it is the line of the nearest existing ancestor if the field is absent, or 0 if the path is empty.
+func lineOf(root *yaml.Node, path string) int {
+	if path == "" {
+		return 0
+	}
+
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) != 0 {
+		node = node.Content[0]
+	}
+
+	line := 0
+	for _, m := range pathSegment.FindAllStringSubmatch(path, -1) {
+		var next *yaml.Node
+		switch {
+		case m[1] != "" && node.Kind == yaml.SequenceNode:
+			if i, _ := strconv.Atoi(m[1]); i < len(node.Content) {
+				next = node.Content[i]
+				line = next.Line
+			}
+		case m[2] != "" && node.Kind == yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == m[2] {
+					next = node.Content[i+1]
+					line = node.Content[i].Line
+					break
+				}
+			}
+		}
+
+		if next == nil {
+			break
+		}
+		node = next
+	}
+
+	return line
+}
@@ -0,0 +1,71 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+	"strings"
+	"testing"
+)
+
+func TestLintConfig(t *testing.T) {
+	var out strings.Builder
+	assert.Equal(t, 0, lintConfig([]string{findTestdata(t, configYaml)}, &out))
+	assert.Equal(t, "", out.String())
+
+	out.Reset()
+	file := findTestdata(t, "config2.yaml")
+	assert.Equal(t, 1, lintConfig([]string{"--config-file=" + file}, &out))
+	assert.Equal(t, file+":5: config_items[0].excluded_repos[0]: owner2/repo1 exists in both repos and excluded_repos\n"+
+		file+": "+missingGlobalConfig+"\n", out.String())
+
+	out.Reset()
+	assert.Equal(t, 1, lintConfig([]string{findTestdata(t, configYaml) + ".absent"}, &out))
+	assert.Contains(t, out.String(), "no such file or directory")
+
+	out.Reset()
+	assert.Equal(t, 2, lintConfig(nil, &out))
+	assert.Equal(t, "no config file to lint\n", out.String())
+}
+
+func TestLineOf(t *testing.T) {
+	doc := `config_items:
+  - repos:
+      - owner1
+    clear_labels:
+      - lgtm
+locales:
+  zh:
+    user_mark_format: "@{{.Commenter}}"
+`
+	root := new(yaml.Node)
+	assert.Nil(t, yaml.Unmarshal([]byte(doc), root))
+
+	testCases := []struct {
+		path string
+		line int
+	}{
+		{"", 0},
+		{"config_items[0].repos[0]", 3},
+		{"config_items[0].clear_labels", 4},
+		{"config_items[0].feedback_mode", 2},
+		{"config_items[3].repos", 1},
+		{"locales.zh.user_mark_format", 8},
+		{"squash_commit_label", 0},
+	}
+	for i := range testCases {
+		assert.Equal(t, testCases[i].line, lineOf(root, testCases[i].path), testCases[i].path)
+	}
+}
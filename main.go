@@ -14,14 +14,32 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"github.com/opensourceways/robot-framework-lib/framework"
+	"github.com/opensourceways/server-common-lib/interrupts"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"net/http"
 	"os"
+	"strings"
 )
 
 const component = "robot-universal-label"
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "lint", "validate":
+			os.Exit(lintConfig(os.Args[2:], os.Stdout))
+		case "explain":
+			os.Exit(explainConfig(os.Args[2:], os.Stdout))
+		case "audit":
+			os.Exit(queryAudit(os.Args[2:], os.Stdout))
+		case "replay":
+			os.Exit(replayWebhook(os.Args[2:], os.Stdout))
+		}
+	}
 
 	opt := new(robotOptions)
 	// Gather the necessary arguments from command line for project startup
@@ -29,7 +47,41 @@ func main() {
 	if opt.interrupt {
 		return
 	}
+	if opt.audit != nil {
+		defer func() { _ = opt.audit.Close() }()
+	}
+
+	if opt.tracer != nil {
+		otel.SetTracerProvider(opt.tracer)
+		// the spans in the batch are flushed after the server is shut down, then the file of them is closed
+		defer func() {
+			_ = opt.tracer.Shutdown(context.Background())
+			if opt.traceOutput != nil {
+				_ = opt.traceOutput.Close()
+			}
+		}()
+	}
+
+	cnf.warn(logrus.WithField("component", component))
+	live := newLiveConfig(opt.service.ConfigFile, cnf, logrus.WithField("component", component))
+	live.check = opt.checkConfig
+	if opt.reloadInterval > 0 {
+		interrupts.TickLiteral(live.watch, opt.reloadInterval)
+	}
 
-	bot := newRobot(cnf, token)
+	bot := newRobot(live, token, opt)
+	if opt.tokens != nil && opt.tokens.rotates() {
+		interrupts.TickLiteral(func() { bot.rotateToken(opt.tokens) }, opt.tokenRefreshInterval)
+	}
+	if len(opt.credentials) != 0 {
+		interrupts.TickLiteral(func() { bot.rotateCredentials(opt.credentials) }, opt.tokenRefreshInterval)
+	}
+	if opt.cacheEventsPath != "" && bot.cache != nil {
+		http.Handle("/"+strings.TrimPrefix(opt.cacheEventsPath, "/"), bot.cache.handler(opt.cacheEventsSecret))
+	}
+	if opt.metricsPath != "" {
+		// the framework serves the webhook with the default mux as well
+		http.Handle("/"+strings.TrimPrefix(opt.metricsPath, "/"), bot.metrics.handler())
+	}
 	framework.StartupServer(framework.NewServer(bot, opt.service), opt.service)
 }
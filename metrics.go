@@ -0,0 +1,289 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"github.com/opensourceways/robot-framework-lib/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"net/http"
+	"time"
+)
+
+const metricsNamespace = "robot_universal_label"
+
+// metricsRepoOther is the repository label of the events of the repositories which are not configured
+const metricsRepoOther = "other"
+
+// the event types of the metrics
+const (
+	eventTypePullRequest        = "pull_request"
+	eventTypeIssueComment       = "issue_comment"
+	eventTypePullRequestComment = "pull_request_comment"
+)
+
+// robotMetrics collects the metrics of the bot, they are served on the same server as the webhook.
+// A nil robotMetrics collects nothing.
+type robotMetrics struct {
+	registry *prometheus.Registry
+
+	events          *prometheus.CounterVec
+	commands        *prometheus.CounterVec
+	labels          *prometheus.CounterVec
+	squashLabels    *prometheus.CounterVec
+	clientDurations *prometheus.HistogramVec
+	clientFailures  *prometheus.CounterVec
+	cacheRequests   *prometheus.CounterVec
+	rateLimitWaits  *prometheus.HistogramVec
+}
+
+func newRobotMetrics() *robotMetrics {
+	m := &robotMetrics{
+		registry: prometheus.NewRegistry(),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "events_received_total",
+			Help:      "The number of the events received, by the event type and the repository.",
+		}, []string{"type", "repo"}),
+		commands: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "commands_parsed_total",
+			Help:      "The number of the label commands parsed from the comments, by the repository and the action.",
+		}, []string{"repo", "action"}),
+		labels: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "labels_changed_total",
+			Help:      "The number of the labels added or removed, by the repository, the target, the action and the trigger.",
+		}, []string{"repo", "target", "action", "trigger"}),
+		squashLabels: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "squash_labels_applied_total",
+			Help:      "The number of the squash commit labels added to the pull requests, by the repository.",
+		}, []string{"repo"}),
+		clientDurations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "client_call_duration_seconds",
+			Help:      "The latency of the calls to the code hosting platform, by the method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		clientFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "client_call_failures_total",
+			Help:      "The number of the failed calls to the code hosting platform, by the method.",
+		}, []string{"method"}),
+		cacheRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "cache_requests_total",
+			Help:      "The number of the reads looked up in the cache, by the cache and the result which is hit or miss.",
+		}, []string{"cache", "result"}),
+		rateLimitWaits: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "rate_limit_wait_seconds",
+			Help:      "The time the requests waited for the budget of the credential, by the priority which is read or mutation.",
+			Buckets:   []float64{0.1, 1, 5, 15, 60, 300, 900},
+		}, []string{"priority"}),
+	}
+
+	m.registry.MustRegister(
+		m.events, m.commands, m.labels, m.squashLabels, m.clientDurations, m.clientFailures, m.cacheRequests, m.rateLimitWaits,
+		collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// handler serves the metrics in the Prometheus exposition format
+func (m *robotMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// observeEvent counts the event, the ones of the repositories which are not configured are counted
+// as the repository other, so that the senders of the webhook can not grow the label values unboundedly.
+func (m *robotMetrics) observeEvent(eventType, org, repo string, configured bool) {
+	if m == nil {
+		return
+	}
+
+	r := metricsRepoOther
+	if configured {
+		r = org + "/" + repo
+	}
+	m.events.WithLabelValues(eventType, r).Inc()
+}
+
+func (m *robotMetrics) observeCommands(org, repo string, addLabels, removeLabels []string) {
+	if m == nil {
+		return
+	}
+
+	m.commands.WithLabelValues(org+"/"+repo, auditActionAdd).Add(float64(len(addLabels)))
+	m.commands.WithLabelValues(org+"/"+repo, auditActionRemove).Add(float64(len(removeLabels)))
+}
+
+// observeMutation counts the labels of a successful label mutation
+func (m *robotMetrics) observeMutation(r *auditRecord) {
+	if m == nil || !r.Success {
+		return
+	}
+
+	m.labels.WithLabelValues(r.Org+"/"+r.Repo, r.Target, r.Action, r.Trigger).Add(float64(len(r.Labels)))
+	if r.Trigger == auditTriggerSquash && r.Action == auditActionAdd {
+		m.squashLabels.WithLabelValues(r.Org + "/" + r.Repo).Inc()
+	}
+}
+
+// observeCall records the latency of a call to the client since start, and counts it if it failed
+func (m *robotMetrics) observeCall(method string, start time.Time, success *bool) {
+	if m == nil {
+		return
+	}
+
+	m.clientDurations.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if !*success {
+		m.clientFailures.WithLabelValues(method).Inc()
+	}
+}
+
+// observeCacheLookup counts a lookup of the cache
+func (m *robotMetrics) observeCacheLookup(cache string, hit bool) {
+	if m == nil {
+		return
+	}
+
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheRequests.WithLabelValues(cache, result).Inc()
+}
+
+// observeRateLimitWait records the time a request waited for the budget, the requests which did not wait are not recorded
+func (m *robotMetrics) observeRateLimitWait(priority string, waited time.Duration) {
+	if m == nil || waited == 0 {
+		return
+	}
+
+	m.rateLimitWaits.WithLabelValues(priority).Observe(waited.Seconds())
+}
+
+// instrumentedClient observes the calls to the code hosting platform made through iClient,
+// and traces them as the children of the span in ctx.
+// The event checks are not calls to the platform, they are passed through by the embedded iClient.
+type instrumentedClient struct {
+	iClient
+	metrics *robotMetrics
+	ctx     context.Context
+}
+
+// observe starts observing a call of the method, the returned func ends it with the outcome in success
+func (c *instrumentedClient) observe(method string, success *bool) func() {
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	start := time.Now()
+	_, span := otel.Tracer(tracerName).Start(ctx, "iClient."+method)
+
+	return func() {
+		c.metrics.observeCall(method, start, success)
+		if !*success {
+			span.SetStatus(codes.Error, "the call failed")
+		}
+		span.End()
+	}
+}
+
+func (c *instrumentedClient) CreatePRComment(org, repo, number, comment string) (success bool) {
+	defer c.observe("CreatePRComment", &success)()
+	return c.iClient.CreatePRComment(org, repo, number, comment)
+}
+
+func (c *instrumentedClient) CreateIssueComment(org, repo, number, comment string) (success bool) {
+	defer c.observe("CreateIssueComment", &success)()
+	return c.iClient.CreateIssueComment(org, repo, number, comment)
+}
+
+func (c *instrumentedClient) AddIssueLabels(org, repo, number string, labels []string) (success bool) {
+	defer c.observe("AddIssueLabels", &success)()
+	return c.iClient.AddIssueLabels(org, repo, number, labels)
+}
+
+func (c *instrumentedClient) RemoveIssueLabels(org, repo, number string, labels []string) (success bool) {
+	defer c.observe("RemoveIssueLabels", &success)()
+	return c.iClient.RemoveIssueLabels(org, repo, number, labels)
+}
+
+func (c *instrumentedClient) AddPRLabels(org, repo, number string, labels []string) (success bool) {
+	defer c.observe("AddPRLabels", &success)()
+	return c.iClient.AddPRLabels(org, repo, number, labels)
+}
+
+func (c *instrumentedClient) RemovePRLabels(org, repo, number string, labels []string) (success bool) {
+	defer c.observe("RemovePRLabels", &success)()
+	return c.iClient.RemovePRLabels(org, repo, number, labels)
+}
+
+func (c *instrumentedClient) GetPullRequestCommits(org, repo, number string) (result []client.PRCommit, success bool) {
+	defer c.observe("GetPullRequestCommits", &success)()
+	return c.iClient.GetPullRequestCommits(org, repo, number)
+}
+
+func (c *instrumentedClient) GetPullRequestLabels(org, repo, number string) (result []string, success bool) {
+	defer c.observe("GetPullRequestLabels", &success)()
+	return c.iClient.GetPullRequestLabels(org, repo, number)
+}
+
+func (c *instrumentedClient) GetIssueLabels(org, repo, number, issueID string) (result []string, success bool) {
+	defer c.observe("GetIssueLabels", &success)()
+	return c.iClient.GetIssueLabels(org, repo, number, issueID)
+}
+
+func (c *instrumentedClient) GetRepoIssueLabels(org, repo string) (result []string, success bool) {
+	defer c.observe("GetRepoIssueLabels", &success)()
+	return c.iClient.GetRepoIssueLabels(org, repo)
+}
+
+func (c *instrumentedClient) CheckPermission(org, repo, username string) (pass, success bool) {
+	defer c.observe("CheckPermission", &success)()
+	return c.iClient.CheckPermission(org, repo, username)
+}
+
+func (c *instrumentedClient) CreatePRCommentReaction(org, repo, commentID, reaction string) (success bool) {
+	defer c.observe("CreatePRCommentReaction", &success)()
+	return c.iClient.CreatePRCommentReaction(org, repo, commentID, reaction)
+}
+
+func (c *instrumentedClient) CreateIssueCommentReaction(org, repo, commentID, reaction string) (success bool) {
+	defer c.observe("CreateIssueCommentReaction", &success)()
+	return c.iClient.CreateIssueCommentReaction(org, repo, commentID, reaction)
+}
+
+func (c *instrumentedClient) ListBotPRComments(org, repo, number string) (result []client.PRComment, success bool) {
+	defer c.observe("ListBotPRComments", &success)()
+	return c.iClient.ListBotPRComments(org, repo, number)
+}
+
+func (c *instrumentedClient) UpdatePRComment(org, repo, commentID, comment string) (success bool) {
+	defer c.observe("UpdatePRComment", &success)()
+	return c.iClient.UpdatePRComment(org, repo, commentID, comment)
+}
+
+func (c *instrumentedClient) GetPullRequestChanges(org, repo, number string) (result []client.CommitFile, success bool) {
+	defer c.observe("GetPullRequestChanges", &success)()
+	return c.iClient.GetPullRequestChanges(org, repo, number)
+}
@@ -0,0 +1,82 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"github.com/opensourceways/robot-framework-lib/client"
+	"github.com/opensourceways/robot-framework-lib/framework"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInstrumentedClient(t *testing.T) {
+	m := newRobotMetrics()
+	cli := &instrumentedClient{iClient: &mockClient{successfulAddPRLabels: true}, metrics: m}
+
+	assert.True(t, cli.AddPRLabels(org, repo, number, []string{"kind/bug"}))
+	assert.False(t, cli.RemovePRLabels(org, repo, number, []string{"kind/bug"}))
+	_, success := cli.CheckPermission(org, repo, "alice")
+	assert.False(t, success)
+
+	assert.Equal(t, 3, testutil.CollectAndCount(m.clientDurations))
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.clientFailures.WithLabelValues("AddPRLabels")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.clientFailures.WithLabelValues("RemovePRLabels")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.clientFailures.WithLabelValues("CheckPermission")))
+}
+
+func TestLabelMetrics(t *testing.T) {
+	m := newRobotMetrics()
+	cli := &mockClient{
+		successfulGetPullRequestCommits: true,
+		successfulGetPullRequestLabels:  true,
+		successfulAddPRLabels:           true,
+		commits:                         make([]client.PRCommit, 2),
+	}
+	bot := &robot{cli: cli, log: framework.NewLogger(), metrics: m, cnf: &configuration{SquashCommitLabel: "stat/needs-squash"}}
+
+	bot.handleSquashLabel(org, repo, number, &repoConfig{SquashConfig: SquashConfig{CommitsThreshold: 1}})
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.squashLabels.WithLabelValues(org+"/"+repo)))
+	assert.Equal(t, float64(1),
+		testutil.ToFloat64(m.labels.WithLabelValues(org+"/"+repo, auditTargetPR, auditActionAdd, auditTriggerSquash)))
+
+	report := &commandReport{commentData: commentData{Org: org, Repo: repo, Number: number}}
+	bot.addPRLabels(org, repo, number, []string{"kind/bug", "sig/doc"}, report)
+	// the labels failed to be removed are not counted
+	bot.removePRLabels(org, repo, number, []string{"lgtm"}, report)
+	assert.Equal(t, float64(2),
+		testutil.ToFloat64(m.labels.WithLabelValues(org+"/"+repo, auditTargetPR, auditActionAdd, auditTriggerCommand)))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.labels))
+
+	m.observeEvent(eventTypePullRequestComment, org, repo, true)
+	m.observeEvent(eventTypePullRequestComment, org, "unknown1", false)
+	m.observeEvent(eventTypePullRequestComment, org, "unknown2", false)
+	m.observeCommands(org, repo, []string{"kind/bug", "sig/doc"}, []string{"lgtm"})
+
+	w := httptest.NewRecorder()
+	m.handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	for _, s := range []string{
+		`robot_universal_label_events_received_total{repo="org1/repo1",type="pull_request_comment"} 1`,
+		`robot_universal_label_events_received_total{repo="other",type="pull_request_comment"} 2`,
+		`robot_universal_label_commands_parsed_total{action="add",repo="org1/repo1"} 2`,
+		`robot_universal_label_commands_parsed_total{action="remove",repo="org1/repo1"} 1`,
+		`robot_universal_label_squash_labels_applied_total{repo="org1/repo1"} 1`,
+	} {
+		assert.True(t, strings.Contains(body, s), s)
+	}
+}
@@ -14,11 +14,15 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"github.com/opensourceways/robot-framework-lib/config"
 	"github.com/opensourceways/server-common-lib/secret"
 	"github.com/sirupsen/logrus"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"os"
+	"time"
 )
 
 type robotOptions struct {
@@ -26,6 +30,52 @@ type robotOptions struct {
 	delToken  bool
 	interrupt bool
 	tokenPath string
+	// tokenSourceKind, tokenCommand and tokenRefreshInterval decide where the token comes from and how it is rotated
+	tokenSourceKind      string
+	tokenCommand         string
+	tokenRefreshInterval time.Duration
+	tokens               *tokenSource
+	// authMode decides how the bot authenticates, the GitHub App mode mints the installation tokens of the orgs
+	authMode      string
+	appID         string
+	appPrivateKey string
+	app           *githubApp
+	// credentialsDir is the directory of the named credentials which the config items reference
+	credentialsDir   string
+	credentials      map[string]*tokenSource
+	credentialTokens map[string][]byte
+	// cacheTTL is how long the reads are cached, 0 disables the cache
+	cacheTTL time.Duration
+	// cacheEventsPath is the path of the webhook of the label and the member events which invalidate the cache,
+	// the webhooks are verified by the secret loaded from cacheEventsSecretPath
+	cacheEventsPath       string
+	cacheEventsSecretPath string
+	cacheEventsSecret     []byte
+	// rateLimit is the budget of the API requests of each credential in every rateLimitInterval, 0 disables the limit.
+	// rateLimitReserve is the share of the budget reserved for the mutations.
+	rateLimit         int
+	rateLimitInterval time.Duration
+	rateLimitReserve  float64
+	// prChangesSize and prChangesTTL bound the changes of the open PRs remembered by the process
+	prChangesSize int
+	prChangesTTL  time.Duration
+	// apiURLs are the URLs of the APIs of the platforms other than GitCode
+	apiURLs   platformAPIURLs
+	auditSink string
+	auditPath string
+	audit     auditSink
+	// metricsPath is the path of the metrics endpoint on the server of the webhook, empty disables it
+	metricsPath string
+	// traceExporter and traceFile decide where the spans are exported
+	traceExporter string
+	traceFile     string
+	tracer        *sdktrace.TracerProvider
+	// traceOutput is the file of the file exporter, it is nil for the other exporters
+	traceOutput *os.File
+	// dryRun intercepts the mutations of all the repositories, the per-repo one is dry_run of the config
+	dryRun bool
+	// reloadInterval is the interval of checking the config file for changes, 0 disables the reload
+	reloadInterval time.Duration
 }
 
 func (o *robotOptions) addFlags(fs *flag.FlagSet) {
@@ -38,9 +88,180 @@ func (o *robotOptions) addFlags(fs *flag.FlagSet) {
 		&o.delToken, "del-token", true,
 		"An flag to delete token secret file.",
 	)
+	fs.StringVar(
+		&o.tokenSourceKind, "token-source", tokenSourceFile,
+		"The source of the token, it is one of file, watch and command. The file is loaded once, "+
+			"the watched file and the output of the credential command are checked for the rotated token.",
+	)
+	fs.StringVar(
+		&o.tokenCommand, "token-command", "",
+		"The credential command run by sh which prints the token, it is used by the command token source.",
+	)
+	fs.DurationVar(
+		&o.tokenRefreshInterval, "token-refresh-interval", time.Minute,
+		"The interval of checking the watched token file and the named credentials, or running the credential command.",
+	)
+	fs.StringVar(
+		&o.authMode, "auth-mode", authModeToken,
+		"The mode of authenticating the bot, it is one of token and github-app. "+
+			"The github-app mode mints the installation tokens of the orgs instead of using the token source.",
+	)
+	fs.StringVar(
+		&o.appID, "github-app-id", "",
+		"The id of the GitHub App, it is used by the github-app auth mode.",
+	)
+	fs.StringVar(
+		&o.appPrivateKey, "github-app-private-key", "",
+		"Path to the PEM file of the private key of the GitHub App, it is used by the github-app auth mode.",
+	)
+	fs.StringVar(
+		&o.apiURLs.github, "github-api-url", githubAPIURL,
+		"The URL of the GitHub API, e.g. of GitHub Enterprise Server. The installation tokens are minted by it as well.",
+	)
+	fs.StringVar(
+		&o.apiURLs.gitee, "gitee-api-url", giteeAPIURL,
+		"The URL of the Gitee API.",
+	)
+	fs.StringVar(
+		&o.apiURLs.gitlab, "gitlab-api-url", gitlabAPIURL,
+		"The URL of the GitLab API, e.g. of a self-managed instance.",
+	)
+	fs.StringVar(
+		&o.credentialsDir, "credentials-dir", "",
+		"Path to the directory of the named credentials, e.g. a mounted secret. Each file holds the token "+
+			"of the credential named by the file name, which the config items reference by credential. "+
+			"The files are checked for the rotated tokens in the same way as the watched token file.",
+	)
+	fs.DurationVar(
+		&o.cacheTTL, "cache-ttl", 0,
+		"How long the labels of the repositories and the permissions of the users are cached, 0 disables the cache.",
+	)
+	fs.StringVar(
+		&o.cacheEventsPath, "cache-events-path", "",
+		"The path of the webhook of the label and the member events on the same port as the webhook, "+
+			"which invalidate the cache. Empty disables it.",
+	)
+	fs.StringVar(
+		&o.cacheEventsSecretPath, "cache-events-secret-path", "",
+		"Path to the file containing the secret of the webhook of the cache events, it is required by the webhook.",
+	)
+	fs.IntVar(
+		&o.rateLimit, "rate-limit", 0,
+		"The number of the API requests which each credential makes in every rate limit interval at most, "+
+			"the requests wait for the budget when it is exhausted. 0 disables the limit.",
+	)
+	fs.DurationVar(
+		&o.rateLimitInterval, "rate-limit-interval", time.Hour,
+		"The interval of the rate limit, the budget is refilled evenly over it.",
+	)
+	fs.Float64Var(
+		&o.rateLimitReserve, "rate-limit-reserve", 0.1,
+		"The share of the budget reserved for the label and comment mutations, which the reads do not use.",
+	)
+	fs.StringVar(
+		&o.auditSink, "audit-sink", auditSinkNone,
+		"The sink which records the label mutations, it is one of none, stdout, jsonl and sqlite.",
+	)
+	fs.StringVar(
+		&o.auditPath, "audit-path", "",
+		"Path to the file of the jsonl or sqlite audit sink.",
+	)
+	fs.StringVar(
+		&o.metricsPath, "metrics-path", "metrics",
+		"The path of the Prometheus metrics endpoint on the same port as the webhook, empty disables it.",
+	)
+	fs.StringVar(
+		&o.traceExporter, "trace-exporter", traceExporterNone,
+		"The exporter of the spans, it is one of none, otlp and file. "+
+			"The otlp exporter is configured by the OTEL_EXPORTER_OTLP_* environment variables.",
+	)
+	fs.StringVar(
+		&o.traceFile, "trace-file", "",
+		"Path to the file which the file trace exporter writes the spans to.",
+	)
+	fs.IntVar(
+		&o.prChangesSize, "pr-changes-size", defaultPRChangesSize,
+		"The number of the open PRs whose changes are remembered for skip_clearing_on_rebase and clear_labels_paths, "+
+			"0 means unbounded. They are remembered by the process, so the bot must run as a single replica "+
+			"for the conditions to see the previous push.",
+	)
+	fs.DurationVar(
+		&o.prChangesTTL, "pr-changes-ttl", defaultPRChangesTTL,
+		"How long the changes of an open PR are remembered after its last push, 0 means forever.",
+	)
+	fs.BoolVar(
+		&o.dryRun, "dry-run", false,
+		"Log the label and comment mutations as the intended actions instead of executing them.",
+	)
+	fs.DurationVar(
+		&o.reloadInterval, "config-reload-interval", 10*time.Second,
+		"The interval of checking the config file for changes, the valid changes take effect without restart. "+
+			"0 disables the reload.",
+	)
 }
 
 func (o *robotOptions) validateFlags() (*configuration, []byte) {
+	cnf, token := o.loadFlags()
+	if o.interrupt {
+		return cnf, token
+	}
+	if err := o.checkConfig(cnf); err != nil {
+		logrus.WithError(err).Error("the config does not match the flags")
+		o.interrupt = true
+		return nil, nil
+	}
+	// the sinks are opened after the other flags are validated, so that they are not leaked on the errors
+	o.openSinks()
+
+	return cnf, token
+}
+
+// checkConfig checks the configuration against the flags, it is checked again when the config file is reloaded.
+// The credentials referenced by the items must be loaded, and in the github-app mode, all the repositories
+// must be on GitHub since the app only mints the tokens of GitHub.
+func (o *robotOptions) checkConfig(c *configuration) error {
+	if c == nil {
+		return nil
+	}
+
+	var errs []error
+	for i := range c.ConfigItems {
+		path := fmt.Sprintf("config_items[%d]", i)
+		if name := c.ConfigItems[i].Credential; name != "" {
+			if _, ok := o.credentials[name]; !ok {
+				errs = append(errs, locate(path+".credential", errors.New("unknown credential: "+name)))
+			}
+		}
+		if o.authMode == authModeGitHubApp && c.ConfigItems[i].Platform != platformGitHub {
+			errs = append(errs, locate(path+".platform",
+				errors.New("the repositories must be on github in the github-app auth mode")))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// openSinks opens the audit sink and the trace exporter, the audit sink is closed if the exporter fails.
+func (o *robotOptions) openSinks() {
+	var err error
+	if o.audit, err = newAuditSink(o.auditSink, o.auditPath); err != nil {
+		logrus.WithError(err).Error("fatal error occurred while opening the audit sink")
+		o.interrupt = true
+		return
+	}
+
+	if o.tracer, o.traceOutput, err = newTracerProvider(o.traceExporter, o.traceFile); err != nil {
+		logrus.WithError(err).Error("fatal error occurred while creating the trace exporter")
+		if o.audit != nil {
+			_ = o.audit.Close()
+			o.audit = nil
+		}
+		o.interrupt = true
+	}
+}
+
+// loadFlags validates the flags except the ones of the sinks, and loads the configuration and the token
+func (o *robotOptions) loadFlags() (*configuration, []byte) {
 	if err := o.service.ValidateComposite(); err != nil {
 		logrus.WithError(err).Errorf("invalid service options")
 		o.interrupt = true
@@ -54,6 +275,69 @@ func (o *robotOptions) validateFlags() (*configuration, []byte) {
 		return nil, nil
 	}
 
+	if o.credentialsDir != "" {
+		if o.credentials, o.credentialTokens, err = loadCredentials(o.credentialsDir); err != nil {
+			logrus.WithError(err).Error("fatal error occurred while loading the named credentials")
+			o.interrupt = true
+			return nil, nil
+		}
+	}
+
+	if o.cacheEventsPath != "" && o.cacheTTL > 0 {
+		o.cacheEventsSecret, err = secret.LoadSingleSecret(o.cacheEventsSecretPath)
+		if err == nil && len(o.cacheEventsSecret) == 0 {
+			err = errors.New("the secret is empty")
+		}
+		if err != nil {
+			logrus.WithError(err).Error("fatal error occurred while loading the secret of the cache events webhook")
+			o.interrupt = true
+			return nil, nil
+		}
+	}
+
+	if o.rateLimitReserve < 0 || o.rateLimitReserve >= 1 {
+		logrus.Errorf("invalid rate limit reserve: %v, it must be in [0, 1)", o.rateLimitReserve)
+		o.interrupt = true
+		return nil, nil
+	}
+
+	switch o.authMode {
+	case authModeToken:
+	case authModeGitHubApp:
+		// the installation tokens are minted when the orgs are called, there is no token to load
+		if o.tokenPath != "" || o.tokenCommand != "" || o.tokenSourceKind != tokenSourceFile {
+			logrus.Error("the token source can not be set in the github-app auth mode")
+			o.interrupt = true
+			return nil, nil
+		}
+		if o.app, err = newGitHubApp(o.appID, o.appPrivateKey, o.apiURLs.github, logrus.WithField("component", component)); err != nil {
+			logrus.WithError(err).Error("invalid GitHub App")
+			o.interrupt = true
+		}
+		return configmap.GetConfigmap().(*configuration), nil
+	default:
+		logrus.Errorf("unsupported auth mode: %s", o.authMode)
+		o.interrupt = true
+		return nil, nil
+	}
+
+	if o.tokens, err = newTokenSource(o.tokenSourceKind, o.tokenPath, o.tokenCommand); err != nil {
+		logrus.WithError(err).Error("invalid token source")
+		o.interrupt = true
+		return nil, nil
+	}
+
+	if o.tokens.rotates() {
+		// the watched file is not deleted, it is read again when the token is rotated
+		token, _, err := o.tokens.refresh()
+		if err != nil {
+			logrus.WithError(err).Error("fatal error occurred while loading token")
+			o.interrupt = true
+		}
+
+		return configmap.GetConfigmap().(*configuration), token
+	}
+
 	token, err := secret.LoadSingleSecret(o.tokenPath)
 	if err != nil {
 		logrus.WithError(err).Error("fatal error occurred while loading token")
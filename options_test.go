@@ -14,10 +14,17 @@
 package main
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"flag"
 	"github.com/opensourceways/server-common-lib/utils"
 	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -78,6 +85,9 @@ func TestGatherOptions(t *testing.T) {
 		if want.ConfigItems[i].CommitsThreshold == 0 {
 			want.ConfigItems[i].CommitsThreshold = 1
 		}
+		if want.ConfigItems[i].FeedbackMode == "" {
+			want.ConfigItems[i].FeedbackMode = feedbackModeComment
+		}
 		if want.ConfigItems[i].ClearLabelsByRegexp != "" {
 			r, err := regexp.Compile(want.ConfigItems[i].ClearLabelsByRegexp)
 			if err != nil {
@@ -86,6 +96,64 @@ func TestGatherOptions(t *testing.T) {
 			want.ConfigItems[i].ClearLabelsRegexp = r
 		}
 	}
+	// the parsed templates are compared by the template names only
+	assert.Equal(t, 8, len(got.templates[defaultLocale]))
+	want.templates = got.templates
+	for i := range want.ConfigItems {
+		assert.Equal(t, 0, len(got.ConfigItems[i].templates))
+		want.ConfigItems[i].templates = got.ConfigItems[i].templates
+	}
 	assert.Equal(t, *want, *got)
 	assert.Equal(t, "1231****55324", string(token))
+
+	// the audit sink is not opened if the other flags are invalid, and is closed if the exporter fails
+	audit := "--audit-path=" + filepath.Join(t.TempDir(), "audit.db")
+	opt = new(robotOptions)
+	_, _ = opt.gatherOptions(flag.NewFlagSet(args[0], flag.ExitOnError),
+		append(args[1:5:5], "--audit-sink=sqlite", audit, "--rate-limit-reserve=1")...)
+	assert.Equal(t, true, opt.interrupt)
+	assert.Nil(t, opt.audit)
+	opt = new(robotOptions)
+	_, _ = opt.gatherOptions(flag.NewFlagSet(args[0], flag.ExitOnError),
+		append(args[1:5:5], "--audit-sink=sqlite", audit, "--trace-exporter=zipkin")...)
+	assert.Equal(t, true, opt.interrupt)
+	assert.Nil(t, opt.audit)
+}
+
+func TestCheckConfig(t *testing.T) {
+	cnf, problems := loadConfigFile(findTestdata(t, "config3.yaml"))
+	assert.Nil(t, problems)
+	assert.Nil(t, (&robotOptions{authMode: authModeToken}).checkConfig(cnf))
+
+	// the github-app mode only mints the tokens of GitHub
+	opt := &robotOptions{authMode: authModeGitHubApp}
+	assert.EqualError(t, opt.checkConfig(cnf), "config_items[0].platform: the repositories must be on github in the github-app auth mode\n"+
+		"config_items[1].platform: the repositories must be on github in the github-app auth mode\n"+
+		"config_items[2].platform: the repositories must be on github in the github-app auth mode")
+	for i := range cnf.ConfigItems {
+		cnf.ConfigItems[i].Platform = platformGitHub
+	}
+	assert.Nil(t, opt.checkConfig(cnf))
+
+	// the token source is not used in the github-app mode
+	b, err := os.ReadFile(findTestdata(t, "config3.yaml"))
+	assert.Nil(t, err)
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.Nil(t, os.WriteFile(file, []byte(strings.ReplaceAll(string(b), "  - repos:", "  - platform: github\n    repos:")), 0o600))
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	keyFile := filepath.Join(t.TempDir(), "app.pem")
+	assert.Nil(t, os.WriteFile(keyFile,
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0o600))
+	args := []string{commandConfigFilePrefix + file, commandDelToken,
+		"--auth-mode=github-app", "--github-app-id=1", "--github-app-private-key=" + keyFile}
+	opt = new(robotOptions)
+	_, _ = opt.gatherOptions(flag.NewFlagSet(commandExecFile, flag.ExitOnError), args...)
+	assert.Equal(t, false, opt.interrupt)
+	assert.NotNil(t, opt.app)
+	opt = new(robotOptions)
+	_, _ = opt.gatherOptions(flag.NewFlagSet(commandExecFile, flag.ExitOnError),
+		append(args, commandTokenFilePrefix+findTestdata(t, "token"))...)
+	assert.Equal(t, true, opt.interrupt)
+	assert.Nil(t, opt.app)
 }
@@ -0,0 +1,542 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/opensourceways/robot-framework-lib/client"
+	"github.com/opensourceways/robot-framework-lib/utils"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the code hosting platforms which the repositories of a config item are on
+const (
+	platformGitCode = "gitcode"
+	platformGitHub  = "github"
+	platformGitee   = "gitee"
+	platformGitLab  = "gitlab"
+)
+
+const (
+	giteeAPIURL  = "https://gitee.com/api/v5/"
+	gitlabAPIURL = "https://gitlab.com/api/v4/"
+	// perPage is the size of the pages of the lists
+	perPage = 100
+)
+
+// platformAPIURLs are the URLs of the APIs of the platforms, they are configurable for the self-hosted ones
+type platformAPIURLs struct {
+	github string
+	gitee  string
+	gitlab string
+}
+
+// platformClient delegates the calls of a repository to the client of the platform
+// which the config item of the repository is on, the label semantics are the same on all the platforms.
+// The client of a platform is created the first time the platform is needed, e.g. the GitCode client
+// which calls the API when it is created is not created if no repository is on GitCode.
+type platformClient struct {
+	// platformOf returns the platform of the repository
+	platformOf func(org, repo string) string
+	// platforms returns the platforms of the config items, their clients are created when validated
+	platforms func() []string
+	// create creates the client of the platform
+	create func(platform string) iClient
+	log    *logrus.Entry
+
+	lock    sync.Mutex
+	clients map[string]iClient
+}
+
+// newPlatformClient creates the client of a token, the requests of the clients of all the platforms
+// are charged to the limit of the credential of the token.
+func newPlatformClient(token []byte, urls platformAPIURLs, limit *requestLimit,
+	platformOf func(org, repo string) string, platforms func() []string, logger *logrus.Entry) *platformClient {
+	return &platformClient{
+		platformOf: platformOf,
+		platforms:  platforms,
+		create: func(platform string) iClient {
+			switch platform {
+			case platformGitHub:
+				cli := newGitHubClient(token, urls.github, logger)
+				cli.api.limit = limit
+				return cli
+			case platformGitee:
+				cli := newGiteeClient(token, urls.gitee, logger)
+				cli.api.limit = limit
+				return cli
+			case platformGitLab:
+				cli := newGitLabClient(token, urls.gitlab, logger)
+				cli.api.limit = limit
+				return cli
+			}
+			cli := newClient(token, logger)
+			cli.limit = limit
+			return newRateLimitedClient(cli, limit)
+		},
+		log:     logger,
+		clients: map[string]iClient{},
+	}
+}
+
+// validate creates the clients of the platforms of the config items, and returns the error of the first broken one
+func (c *platformClient) validate() error {
+	if c.platforms == nil {
+		return nil
+	}
+
+	for _, p := range c.platforms() {
+		if _, err := c.clientOf(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// clientOf returns the client of the platform, it is created if there is none. The broken client
+// is not kept, so that it is created again the next time. The API is called without holding the lock.
+func (c *platformClient) clientOf(platform string) (iClient, error) {
+	c.lock.Lock()
+	cli, ok := c.clients[platform]
+	c.lock.Unlock()
+	if ok || c.create == nil {
+		return cli, nil
+	}
+
+	cli = c.create(platform)
+	if err := validateClient(cli); err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// the client may be created by another call at the same time
+	if created, ok := c.clients[platform]; ok {
+		return created, nil
+	}
+	c.clients[platform] = cli
+
+	return cli, nil
+}
+
+func (c *platformClient) of(org, repo string) iClient {
+	platform := c.platformOf(org, repo)
+	cli, err := c.clientOf(platform)
+	if err != nil || cli == nil {
+		c.log.WithError(err).Errorf("the client of %s is unavailable for %s/%s", platform, org, repo)
+		return unavailableClient{}
+	}
+
+	return cli
+}
+
+func (c *platformClient) CreatePRComment(org, repo, number, comment string) bool {
+	return c.of(org, repo).CreatePRComment(org, repo, number, comment)
+}
+
+func (c *platformClient) CreateIssueComment(org, repo, number, comment string) bool {
+	return c.of(org, repo).CreateIssueComment(org, repo, number, comment)
+}
+
+func (c *platformClient) AddIssueLabels(org, repo, number string, labels []string) bool {
+	return c.of(org, repo).AddIssueLabels(org, repo, number, labels)
+}
+
+func (c *platformClient) RemoveIssueLabels(org, repo, number string, labels []string) bool {
+	return c.of(org, repo).RemoveIssueLabels(org, repo, number, labels)
+}
+
+func (c *platformClient) AddPRLabels(org, repo, number string, labels []string) bool {
+	return c.of(org, repo).AddPRLabels(org, repo, number, labels)
+}
+
+func (c *platformClient) RemovePRLabels(org, repo, number string, labels []string) bool {
+	return c.of(org, repo).RemovePRLabels(org, repo, number, labels)
+}
+
+func (c *platformClient) CheckIfPRCreateEvent(evt *client.GenericEvent) bool {
+	return c.of(utils.GetString(evt.Org), utils.GetString(evt.Repo)).CheckIfPRCreateEvent(evt)
+}
+
+func (c *platformClient) CheckIfPRSourceCodeUpdateEvent(evt *client.GenericEvent) bool {
+	return c.of(utils.GetString(evt.Org), utils.GetString(evt.Repo)).CheckIfPRSourceCodeUpdateEvent(evt)
+}
+
+func (c *platformClient) GetPullRequestCommits(org, repo, number string) ([]client.PRCommit, bool) {
+	return c.of(org, repo).GetPullRequestCommits(org, repo, number)
+}
+
+func (c *platformClient) GetPullRequestLabels(org, repo, number string) ([]string, bool) {
+	return c.of(org, repo).GetPullRequestLabels(org, repo, number)
+}
+
+func (c *platformClient) GetIssueLabels(org, repo, number, issueID string) ([]string, bool) {
+	return c.of(org, repo).GetIssueLabels(org, repo, number, issueID)
+}
+
+func (c *platformClient) GetRepoIssueLabels(org, repo string) ([]string, bool) {
+	return c.of(org, repo).GetRepoIssueLabels(org, repo)
+}
+
+func (c *platformClient) CheckPermission(org, repo, username string) (bool, bool) {
+	return c.of(org, repo).CheckPermission(org, repo, username)
+}
+
+func (c *platformClient) CreatePRCommentReaction(org, repo, commentID, reaction string) bool {
+	return c.of(org, repo).CreatePRCommentReaction(org, repo, commentID, reaction)
+}
+
+func (c *platformClient) CreateIssueCommentReaction(org, repo, commentID, reaction string) bool {
+	return c.of(org, repo).CreateIssueCommentReaction(org, repo, commentID, reaction)
+}
+
+func (c *platformClient) ListBotPRComments(org, repo, number string) ([]client.PRComment, bool) {
+	return c.of(org, repo).ListBotPRComments(org, repo, number)
+}
+
+func (c *platformClient) UpdatePRComment(org, repo, commentID, comment string) bool {
+	return c.of(org, repo).UpdatePRComment(org, repo, commentID, comment)
+}
+
+func (c *platformClient) GetPullRequestChanges(org, repo, number string) ([]client.CommitFile, bool) {
+	return c.of(org, repo).GetPullRequestChanges(org, repo, number)
+}
+
+// unavailableClient fails every call, it stands for the client of a platform which can not be created
+type unavailableClient struct{}
+
+func (unavailableClient) CreatePRComment(org, repo, number, comment string) bool {
+	return false
+}
+
+func (unavailableClient) CreateIssueComment(org, repo, number, comment string) bool {
+	return false
+}
+
+func (unavailableClient) AddIssueLabels(org, repo, number string, labels []string) bool {
+	return false
+}
+
+func (unavailableClient) RemoveIssueLabels(org, repo, number string, labels []string) bool {
+	return false
+}
+
+func (unavailableClient) AddPRLabels(org, repo, number string, labels []string) bool {
+	return false
+}
+
+func (unavailableClient) RemovePRLabels(org, repo, number string, labels []string) bool {
+	return false
+}
+
+func (unavailableClient) CheckIfPRCreateEvent(evt *client.GenericEvent) bool {
+	return false
+}
+
+func (unavailableClient) CheckIfPRSourceCodeUpdateEvent(evt *client.GenericEvent) bool {
+	return false
+}
+
+func (unavailableClient) GetPullRequestCommits(org, repo, number string) ([]client.PRCommit, bool) {
+	return nil, false
+}
+
+func (unavailableClient) GetPullRequestLabels(org, repo, number string) ([]string, bool) {
+	return nil, false
+}
+
+func (unavailableClient) GetIssueLabels(org, repo, number, issueID string) ([]string, bool) {
+	return nil, false
+}
+
+func (unavailableClient) GetRepoIssueLabels(org, repo string) ([]string, bool) {
+	return nil, false
+}
+
+func (unavailableClient) CheckPermission(org, repo, username string) (bool, bool) {
+	return false, false
+}
+
+func (unavailableClient) CreatePRCommentReaction(org, repo, commentID, reaction string) bool {
+	return false
+}
+
+func (unavailableClient) CreateIssueCommentReaction(org, repo, commentID, reaction string) bool {
+	return false
+}
+
+func (unavailableClient) ListBotPRComments(org, repo, number string) ([]client.PRComment, bool) {
+	return nil, false
+}
+
+func (unavailableClient) UpdatePRComment(org, repo, commentID, comment string) bool {
+	return false
+}
+
+func (unavailableClient) GetPullRequestChanges(org, repo, number string) ([]client.CommitFile, bool) {
+	return nil, false
+}
+
+// platform returns the platform of the config item, it is GitCode if not set
+func (c *repoConfig) platform() string {
+	if c == nil || c.Platform == "" {
+		return platformGitCode
+	}
+
+	return c.Platform
+}
+
+// platformOf returns the platform of the repository, it is GitCode if the repository is not configured
+func (bot *robot) platformOf(org, repo string) string {
+	// the client is shared by the events, so it follows the current configuration
+	return bot.currentConfig().getRepoConfig(org, repo).platform()
+}
+
+// platforms returns the platforms of the config items of the current configuration
+func (bot *robot) platforms() []string {
+	var platforms []string
+	for i, items := 0, bot.currentConfig().ConfigItems; i < len(items); i++ {
+		if p := items[i].platform(); !slices.Contains(platforms, p) {
+			platforms = append(platforms, p)
+		}
+	}
+
+	return platforms
+}
+
+// restClient calls the REST API of a platform with JSON
+type restClient struct {
+	baseURL string
+	// authorize sets the credential of the request
+	authorize  func(req *http.Request) error
+	httpClient *http.Client
+	log        *logrus.Entry
+	// limit charges each request, e.g. each page of a list, the requests are not limited if it is nil
+	limit *requestLimit
+
+	lock sync.Mutex
+	// login is the login name of the user of the credential, it is empty until it is fetched
+	login string
+}
+
+func newRestClient(baseURL string, authorize func(req *http.Request) error, log *logrus.Entry) *restClient {
+	return &restClient{
+		baseURL:    strings.TrimSuffix(baseURL, "/") + "/",
+		authorize:  authorize,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		log:        log,
+	}
+}
+
+// call calls the API, the request is encoded from in if it is not nil, and the response is decoded into out
+// if it is not nil. It returns the status code, and an error if the call fails.
+func (c *restClient) call(method, path string, in, out any) (int, error) {
+	body := io.Reader(http.NoBody)
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	if err = c.authorize(req); err != nil {
+		return 0, err
+	}
+
+	if method == http.MethodGet {
+		c.limit.wait(priorityRead)
+	} else {
+		c.limit.wait(priorityMutation)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	if out != nil {
+		err = json.NewDecoder(resp.Body).Decode(out)
+	}
+
+	return resp.StatusCode, err
+}
+
+// do calls the API and logs the failure, it returns true if the call succeeds
+func (c *restClient) do(method, path string, in, out any) bool {
+	if _, err := c.call(method, path, in, out); err != nil {
+		c.log.WithError(err).Error("failed to call the API")
+		return false
+	}
+
+	return true
+}
+
+// user returns the login name of the user of the credential, it is fetched once
+func (c *restClient) user() (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.login == "" {
+		var u restUser
+		if !c.do(http.MethodGet, "user", nil, &u) || u.name() == "" {
+			return "", false
+		}
+		c.login = u.name()
+	}
+
+	return c.login, true
+}
+
+// listAll gets the items of all the pages of the list
+func listAll[T any](c *restClient, path string) ([]T, bool) {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+
+	var all []T
+	for page := 1; ; page++ {
+		var items []T
+		if !c.do(http.MethodGet, fmt.Sprintf("%s%sper_page=%d&page=%d", path, sep, perPage, page), nil, &items) {
+			return nil, false
+		}
+		all = append(all, items...)
+		if len(items) < perPage {
+			return all, true
+		}
+	}
+}
+
+// unescapeLabels returns the labels which are query escaped by the bot before they are removed
+func unescapeLabels(labels []string) []string {
+	r := make([]string, len(labels))
+	for i := range labels {
+		if s, err := url.QueryUnescape(labels[i]); err == nil {
+			r[i] = s
+		} else {
+			r[i] = labels[i]
+		}
+	}
+
+	return r
+}
+
+// the labels, comments and commits in the same shapes on GitHub and Gitee
+
+type restLabel struct {
+	Name string `json:"name"`
+}
+
+func labelNames(labels []restLabel) []string {
+	names := make([]string, len(labels))
+	for i := range labels {
+		names[i] = labels[i].Name
+	}
+
+	return names
+}
+
+// restUser is the author of a comment, or the user of the credential. GitLab names the login username.
+type restUser struct {
+	Login    string `json:"login"`
+	Username string `json:"username"`
+}
+
+func (u restUser) name() string {
+	if u.Login != "" {
+		return u.Login
+	}
+
+	return u.Username
+}
+
+type restComment struct {
+	ID   int64    `json:"id"`
+	Body string   `json:"body"`
+	User restUser `json:"user"`
+	// App is the GitHub App which the comment is created by, it is nil if a user creates it
+	App *struct {
+		ID       int64  `json:"id"`
+		ClientID string `json:"client_id"`
+	} `json:"performed_via_github_app"`
+}
+
+// prComments returns the comments which own reports true for
+func prComments(comments []restComment, own func(cm *restComment) bool) []client.PRComment {
+	var r []client.PRComment
+	for i := range comments {
+		if own(&comments[i]) {
+			r = append(r, client.PRComment{ID: fmt.Sprint(comments[i].ID), Body: comments[i].Body})
+		}
+	}
+
+	return r
+}
+
+// listUserComments lists the comments created by the user of the credential
+func listUserComments(c *restClient, path string) ([]client.PRComment, bool) {
+	login, ok := c.user()
+	if !ok {
+		return nil, false
+	}
+	comments, success := listAll[restComment](c, path)
+
+	return prComments(comments, func(cm *restComment) bool { return cm.User.Login == login }), success
+}
+
+type restCommit struct {
+	Commit struct {
+		Author    restCommitUser `json:"author"`
+		Committer restCommitUser `json:"committer"`
+	} `json:"commit"`
+}
+
+type restCommitUser struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+func prCommits(commits []restCommit) []client.PRCommit {
+	r := make([]client.PRCommit, len(commits))
+	for i := range commits {
+		c := &commits[i].Commit
+		r[i] = client.PRCommit{
+			AuthorName: c.Author.Name, AuthorEmail: c.Author.Email,
+			CommitterName: c.Committer.Name, CommitterEmail: c.Committer.Email,
+		}
+	}
+
+	return r
+}
@@ -0,0 +1,221 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"encoding/json"
+	"github.com/opensourceways/robot-framework-lib/client"
+	"github.com/opensourceways/robot-framework-lib/framework"
+	"github.com/opensourceways/server-common-lib/config"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+// platformServer records the requests to the API of a platform and answers them with the responses by path
+type platformServer struct {
+	*httptest.Server
+	requests  []string
+	responses map[string]string
+}
+
+func newPlatformServer(t *testing.T, responses map[string]string) *platformServer {
+	s := &platformServer{responses: responses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.requests = append(s.requests, r.Method+" "+r.URL.EscapedPath()+" "+string(body))
+		resp, ok := responses[r.Method+" "+r.URL.EscapedPath()]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(resp))
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func TestPlatformClient(t *testing.T) {
+	github := newPlatformServer(t, map[string]string{
+		"GET /repos/gh/repo1/issues/1/labels":                `[{"name": "kind/bug"}]`,
+		"POST /repos/gh/repo1/issues/1/labels":               `[]`,
+		"DELETE /repos/gh/repo1/issues/1/labels/kind%2Fbug":  `[]`,
+		"GET /repos/gh/repo1/collaborators/alice/permission": `{"permission": "write"}`,
+		"GET /repos/gh/repo1/pulls/1/files":                  `[{"filename": "a.go", "status": "modified", "patch": "@@ -1 +1 @@"}]`,
+		"POST /repos/gh/repo1/issues/comments/9/reactions":   `{}`,
+		"GET /repos/gh/repo1/pulls/1/commits":                `[{"commit": {"author": {"name": "a", "email": "a@x"}}}]`,
+		"GET /repos/gh/repo1/collaborators/bob/permission":   `{"permission": "read"}`,
+		"GET /user": `{"login": "robot"}`,
+		"GET /repos/gh/repo1/issues/1/comments": `[{"id": 1, "body": "a", "user": {"login": "robot"}},
+			{"id": 2, "body": "b", "user": {"login": "alice"}},
+			{"id": 3, "body": "c", "user": {"login": "app[bot]"}, "performed_via_github_app": {"id": 5}}]`,
+	})
+	gitee := newPlatformServer(t, map[string]string{
+		"GET /repos/ge/repo1/pulls/1/labels":                 `[{"name": "kind/bug"}]`,
+		"POST /repos/ge/repo1/pulls/1/labels":                `[]`,
+		"DELETE /repos/ge/repo1/pulls/1/labels/kind%2Fbug,a": ``,
+	})
+	gitlab := newPlatformServer(t, map[string]string{
+		"GET /projects/gl%2Frepo1/merge_requests/1": `{"labels": ["kind/bug"]}`,
+		"PUT /projects/gl%2Frepo1/merge_requests/1": `{}`,
+		"GET /user": `{"username": "robot"}`,
+		"GET /projects/gl%2Frepo1/merge_requests/1/notes": `[{"id": 7, "body": "hello", "author": {"username": "robot"}},
+			{"id": 8, "system": true}, {"id": 9, "body": "hello", "author": {"username": "alice"}}]`,
+		"PUT /projects/gl%2Frepo1/merge_requests/1/notes/7": `{}`,
+		"GET /users":                                      `[{"id": 3}]`,
+		"GET /projects/gl%2Frepo1/members/all/3":          `{"access_level": 30}`,
+		"GET /projects/gl%2Frepo1/merge_requests/1/diffs": `[{"old_path": "a.go", "new_path": "b.go", "renamed_file": true}]`,
+	})
+
+	cnf := &configuration{ConfigItems: []repoConfig{
+		{RepoFilter: config.RepoFilter{Repos: []string{"gh"}}, Platform: platformGitHub},
+		{RepoFilter: config.RepoFilter{Repos: []string{"ge"}}, Platform: platformGitee},
+		{RepoFilter: config.RepoFilter{Repos: []string{"gl"}}, Platform: platformGitLab},
+	}}
+	bot := &robot{cnf: cnf}
+	// the GitCode client is not created, it calls the API when it is created
+	logger := framework.NewLogger()
+	cli := &platformClient{platformOf: bot.platformOf, clients: map[string]iClient{
+		platformGitHub: newGitHubClient([]byte("token"), github.URL, logger),
+		platformGitee:  newGiteeClient([]byte("token"), gitee.URL, logger),
+		platformGitLab: newGitLabClient([]byte("token"), gitlab.URL, logger),
+	}}
+
+	// GitHub
+	labels, ok := cli.GetPullRequestLabels("gh", "repo1", "1")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"kind/bug"}, labels)
+	assert.True(t, cli.AddPRLabels("gh", "repo1", "1", []string{"sig/doc"}))
+	assert.True(t, cli.RemovePRLabels("gh", "repo1", "1", []string{url.QueryEscape("kind/bug")}))
+	pass, ok := cli.CheckPermission("gh", "repo1", "alice")
+	assert.True(t, ok)
+	assert.True(t, pass)
+	pass, _ = cli.CheckPermission("gh", "repo1", "bob")
+	assert.False(t, pass)
+	files, ok := cli.GetPullRequestChanges("gh", "repo1", "1")
+	assert.True(t, ok)
+	assert.Equal(t, "a.go", *files[0].Filename)
+	assert.Equal(t, "@@ -1 +1 @@", *files[0].Patch.Diff)
+	commits, _ := cli.GetPullRequestCommits("gh", "repo1", "1")
+	assert.Equal(t, "a@x", commits[0].AuthorEmail)
+	assert.True(t, cli.CreatePRCommentReaction("gh", "repo1", "9", reactionSuccess))
+	assert.Equal(t, []string{
+		"GET /repos/gh/repo1/issues/1/labels ",
+		`POST /repos/gh/repo1/issues/1/labels {"labels":["sig/doc"]}`,
+		"DELETE /repos/gh/repo1/issues/1/labels/kind%2Fbug ",
+		"GET /repos/gh/repo1/collaborators/alice/permission ",
+		"GET /repos/gh/repo1/collaborators/bob/permission ",
+		"GET /repos/gh/repo1/pulls/1/files ",
+		"GET /repos/gh/repo1/pulls/1/commits ",
+		`POST /repos/gh/repo1/issues/comments/9/reactions {"content":"+1"}`,
+	}, github.requests)
+	// only the comments of the bot are listed, which are the ones of the app if the client is of an installation
+	comments, _ := cli.ListBotPRComments("gh", "repo1", "1")
+	assert.Equal(t, []client.PRComment{{ID: "1", Body: "a"}}, comments)
+	app := newGitHubClient([]byte("token"), github.URL, logger)
+	app.appID = "5"
+	comments, _ = app.ListBotPRComments("gh", "repo1", "1")
+	assert.Equal(t, []client.PRComment{{ID: "3", Body: "c"}}, comments)
+
+	// Gitee
+	labels, _ = cli.GetPullRequestLabels("ge", "repo1", "1")
+	assert.Equal(t, []string{"kind/bug"}, labels)
+	assert.True(t, cli.AddPRLabels("ge", "repo1", "1", []string{"sig/doc"}))
+	assert.True(t, cli.RemovePRLabels("ge", "repo1", "1", []string{url.QueryEscape("kind/bug"), "a"}))
+	assert.False(t, cli.CreatePRCommentReaction("ge", "repo1", "9", reactionSuccess))
+	assert.Equal(t, `POST /repos/ge/repo1/pulls/1/labels ["sig/doc"]`, gitee.requests[1])
+
+	// GitLab
+	labels, _ = cli.GetPullRequestLabels("gl", "repo1", "1")
+	assert.Equal(t, []string{"kind/bug"}, labels)
+	assert.True(t, cli.AddPRLabels("gl", "repo1", "1", []string{"sig/doc", "kind/feature"}))
+	assert.True(t, cli.RemovePRLabels("gl", "repo1", "1", []string{url.QueryEscape("kind/bug")}))
+	pass, ok = cli.CheckPermission("gl", "repo1", "alice")
+	assert.True(t, ok)
+	assert.True(t, pass)
+	// the note is updated after it is listed
+	assert.False(t, cli.UpdatePRComment("gl", "repo1", "7", "edited"))
+	// the notes of the others are not listed
+	comments, _ = cli.ListBotPRComments("gl", "repo1", "1")
+	assert.Equal(t, []client.PRComment{{ID: "7", Body: "hello"}}, comments)
+	assert.True(t, cli.UpdatePRComment("gl", "repo1", "7", "edited"))
+	files, _ = cli.GetPullRequestChanges("gl", "repo1", "1")
+	assert.Equal(t, "renamed", *files[0].Status)
+	assert.Equal(t, "a.go", *files[0].PreviousFilename)
+
+	var body map[string]string
+	_ = json.Unmarshal([]byte(gitlab.requests[1][len("PUT /projects/gl%2Frepo1/merge_requests/1 "):]), &body)
+	assert.Equal(t, map[string]string{"add_labels": "sig/doc,kind/feature"}, body)
+	assert.Equal(t, `PUT /projects/gl%2Frepo1/merge_requests/1 {"remove_labels":"kind/bug"}`, gitlab.requests[2])
+
+	// the repositories not configured are on GitCode
+	assert.Equal(t, platformGitCode, bot.platformOf("other", "repo1"))
+}
+
+func TestPlatformClientLazily(t *testing.T) {
+	cnf := &configuration{ConfigItems: []repoConfig{
+		{RepoFilter: config.RepoFilter{Repos: []string{"gh"}}, Platform: platformGitHub},
+		{RepoFilter: config.RepoFilter{Repos: []string{"gc"}}},
+	}}
+	bot := &robot{cnf: cnf}
+	repo1 := "repo1"
+	cli := newPlatformClient([]byte("token"), platformAPIURLs{}, nil, bot.platformOf, bot.platforms, framework.NewLogger())
+	var created []string
+	create := cli.create
+	cli.create = func(platform string) iClient {
+		created = append(created, platform)
+		if platform == platformGitCode {
+			// the GitCode client is not created if the token is rejected
+			return &gitcodeClient{}
+		}
+		return create(platform)
+	}
+
+	// no client is created until its platform is needed
+	assert.Equal(t, 0, len(cli.clients))
+	gh, opened := "gh", "opened"
+	assert.True(t, cli.CheckIfPRCreateEvent(&client.GenericEvent{Org: &gh, Repo: &repo1, Action: &opened}))
+	assert.Equal(t, []string{platformGitHub}, created)
+
+	// the broken client is not kept, and its calls fail
+	_, ok := cli.GetRepoIssueLabels("gc", "repo1")
+	assert.False(t, ok)
+	_, ok = cli.GetRepoIssueLabels("gc", "repo1")
+	assert.False(t, ok)
+	assert.Equal(t, []string{platformGitHub, platformGitCode, platformGitCode}, created)
+	assert.Equal(t, 1, len(cli.clients))
+
+	assert.Equal(t, []string{platformGitHub, platformGitCode}, bot.platforms())
+	assert.NotNil(t, cli.validate())
+}
+
+func TestGitLabKnownNotes(t *testing.T) {
+	cli := newGitLabClient([]byte("token"), "", framework.NewLogger())
+	for i := 0; i < gitlabKnownNotes+10; i++ {
+		cli.rememberNote(strconv.Itoa(i), "1")
+	}
+	cli.rememberNote("20", "2")
+
+	// the oldest notes are forgotten
+	assert.Equal(t, gitlabKnownNotes, len(cli.mergeRequests))
+	assert.Equal(t, gitlabKnownNotes, len(cli.notes))
+	_, ok := cli.mergeRequests["9"]
+	assert.False(t, ok)
+	assert.Equal(t, "2", cli.mergeRequests["20"])
+}
@@ -0,0 +1,280 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"github.com/opensourceways/robot-framework-lib/client"
+	"sync"
+	"time"
+)
+
+// the priorities of the calls to the platform
+const (
+	priorityRead     = "read"
+	priorityMutation = "mutation"
+)
+
+// rateLimiter is the budget of the requests of a credential, it is a bucket of the requests which is refilled evenly.
+// The reads leave a reserve of the budget to the mutations and yield to the mutations waiting,
+// and the requests wait for the budget instead of failing when it is exhausted.
+type rateLimiter struct {
+	capacity float64
+	reserve  float64
+	// rate is the requests refilled per second
+	rate  float64
+	now   func() time.Time
+	sleep func(d time.Duration)
+
+	lock     sync.Mutex
+	requests float64
+	last     time.Time
+	// waitingMutations is the number of the mutations waiting for the budget
+	waitingMutations int
+}
+
+func newRateLimiter(requests int, interval time.Duration, reserve float64) *rateLimiter {
+	return &rateLimiter{
+		capacity: float64(requests),
+		reserve:  float64(requests) * reserve,
+		rate:     float64(requests) / interval.Seconds(),
+		now:      time.Now,
+		sleep:    time.Sleep,
+		requests: float64(requests),
+		last:     time.Now(),
+	}
+}
+
+// refill refills the budget for the time since the last refill
+func (l *rateLimiter) refill() {
+	now := l.now()
+	l.requests = min(l.capacity, l.requests+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+}
+
+// take takes a request from the budget, or returns how long to wait for the budget
+func (l *rateLimiter) take(priority string) time.Duration {
+	l.refill()
+
+	floor := 0.0
+	if priority == priorityRead {
+		floor = l.reserve
+		if l.waitingMutations > 0 {
+			// the read waits until the mutations take the budget
+			floor = max(floor, float64(l.waitingMutations))
+		}
+		// the reads are never starved when the bucket is full
+		floor = min(floor, l.capacity-1)
+	}
+	if l.requests-1 >= floor {
+		l.requests--
+		return 0
+	}
+
+	return time.Duration((floor + 1 - l.requests) / l.rate * float64(time.Second))
+}
+
+// wait waits for the budget of a request of the priority, it returns how long it waited
+func (l *rateLimiter) wait(priority string) time.Duration {
+	var waited time.Duration
+	for {
+		l.lock.Lock()
+		d := l.take(priority)
+		if d == 0 {
+			l.lock.Unlock()
+			return waited
+		}
+		if priority == priorityMutation {
+			l.waitingMutations++
+		}
+		l.lock.Unlock()
+
+		l.sleep(d)
+		waited += d
+
+		if priority == priorityMutation {
+			l.lock.Lock()
+			l.waitingMutations--
+			l.lock.Unlock()
+		}
+	}
+}
+
+// charge takes the requests which are made without waiting for the budget, the budget may go below zero,
+// then the next requests wait until it is refilled.
+func (l *rateLimiter) charge(requests int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.refill()
+	l.requests -= float64(requests)
+}
+
+// requestLimit charges the requests of the clients of a credential to the budget of the credential,
+// the requests are not limited if it is nil.
+type requestLimit struct {
+	limiter *rateLimiter
+	metrics *robotMetrics
+}
+
+// wait waits for the budget of a request of the priority
+func (l *requestLimit) wait(priority string) {
+	if l != nil {
+		l.metrics.observeRateLimitWait(priority, l.limiter.wait(priority))
+	}
+}
+
+// charge charges the requests made without waiting for the budget, e.g. the retries of the API client
+func (l *requestLimit) charge(requests int) {
+	if l != nil {
+		l.limiter.charge(requests)
+	}
+}
+
+// rateLimits keeps the budget of each credential by the key of the credential, so that the clients
+// created again for a rotated or a minted again token share the budget of the credential.
+type rateLimits struct {
+	requests int
+	interval time.Duration
+	reserve  float64
+	metrics  *robotMetrics
+
+	lock   sync.Mutex
+	limits map[string]*requestLimit
+}
+
+// newRateLimits limits the requests of each credential to the requests in every interval, the share of reserve
+// of the budget is reserved for the mutations. It returns nil if requests is 0, the requests are not limited then.
+func newRateLimits(requests int, interval time.Duration, reserve float64, metrics *robotMetrics) *rateLimits {
+	if requests <= 0 || interval <= 0 {
+		return nil
+	}
+
+	return &rateLimits{
+		requests: requests, interval: interval, reserve: reserve, metrics: metrics,
+		limits: map[string]*requestLimit{},
+	}
+}
+
+// of returns the limit of the credential of the key, it is created the first time the credential is used
+func (r *rateLimits) of(key string) *requestLimit {
+	if r == nil {
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	l, ok := r.limits[key]
+	if !ok {
+		l = &requestLimit{limiter: newRateLimiter(r.requests, r.interval, r.reserve), metrics: r.metrics}
+		r.limits[key] = l
+	}
+
+	return l
+}
+
+// rateLimitedClient charges the calls of the GitCode framework client, each of which is a request.
+// The API client retries a failed request, so a failed call is charged for the retries after it.
+// The calls which the GitCode client makes itself are charged by it, one for each request.
+type rateLimitedClient struct {
+	iClient
+	limit *requestLimit
+}
+
+func (c *rateLimitedClient) validate() error {
+	return validateClient(c.iClient)
+}
+
+// newRateLimitedClient charges the calls of the client to the limit, the client is not limited if it is nil
+func newRateLimitedClient(cli iClient, limit *requestLimit) iClient {
+	if limit == nil {
+		return cli
+	}
+
+	return &rateLimitedClient{iClient: cli, limit: limit}
+}
+
+// done charges the retries of the failed call
+func (c *rateLimitedClient) done(success bool) bool {
+	if !success {
+		c.limit.charge(requestAttempts - 1)
+	}
+	return success
+}
+
+func (c *rateLimitedClient) CreatePRComment(org, repo, number, comment string) bool {
+	c.limit.wait(priorityMutation)
+	return c.done(c.iClient.CreatePRComment(org, repo, number, comment))
+}
+
+func (c *rateLimitedClient) CreateIssueComment(org, repo, number, comment string) bool {
+	c.limit.wait(priorityMutation)
+	return c.done(c.iClient.CreateIssueComment(org, repo, number, comment))
+}
+
+func (c *rateLimitedClient) AddIssueLabels(org, repo, number string, labels []string) bool {
+	c.limit.wait(priorityMutation)
+	return c.done(c.iClient.AddIssueLabels(org, repo, number, labels))
+}
+
+func (c *rateLimitedClient) RemoveIssueLabels(org, repo, number string, labels []string) bool {
+	c.limit.wait(priorityMutation)
+	return c.done(c.iClient.RemoveIssueLabels(org, repo, number, labels))
+}
+
+func (c *rateLimitedClient) AddPRLabels(org, repo, number string, labels []string) bool {
+	c.limit.wait(priorityMutation)
+	return c.done(c.iClient.AddPRLabels(org, repo, number, labels))
+}
+
+func (c *rateLimitedClient) RemovePRLabels(org, repo, number string, labels []string) bool {
+	c.limit.wait(priorityMutation)
+	return c.done(c.iClient.RemovePRLabels(org, repo, number, labels))
+}
+
+func (c *rateLimitedClient) GetPullRequestCommits(org, repo, number string) ([]client.PRCommit, bool) {
+	c.limit.wait(priorityRead)
+	r, success := c.iClient.GetPullRequestCommits(org, repo, number)
+	return r, c.done(success)
+}
+
+func (c *rateLimitedClient) GetPullRequestLabels(org, repo, number string) ([]string, bool) {
+	c.limit.wait(priorityRead)
+	r, success := c.iClient.GetPullRequestLabels(org, repo, number)
+	return r, c.done(success)
+}
+
+func (c *rateLimitedClient) GetIssueLabels(org, repo, number, issueID string) ([]string, bool) {
+	c.limit.wait(priorityRead)
+	r, success := c.iClient.GetIssueLabels(org, repo, number, issueID)
+	return r, c.done(success)
+}
+
+func (c *rateLimitedClient) GetRepoIssueLabels(org, repo string) ([]string, bool) {
+	c.limit.wait(priorityRead)
+	r, success := c.iClient.GetRepoIssueLabels(org, repo)
+	return r, c.done(success)
+}
+
+func (c *rateLimitedClient) CheckPermission(org, repo, username string) (bool, bool) {
+	c.limit.wait(priorityRead)
+	pass, success := c.iClient.CheckPermission(org, repo, username)
+	return pass, c.done(success)
+}
+
+func (c *rateLimitedClient) GetPullRequestChanges(org, repo, number string) ([]client.CommitFile, bool) {
+	c.limit.wait(priorityRead)
+	r, success := c.iClient.GetPullRequestChanges(org, repo, number)
+	return r, c.done(success)
+}
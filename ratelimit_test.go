@@ -0,0 +1,108 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"github.com/opensourceways/robot-framework-lib/framework"
+	"github.com/opensourceways/robot-universal-label/fakeclient"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRateLimitedClient(t *testing.T) {
+	fake := fakeclient.New()
+	fake.AddRepo("owner", "repo1", "kind/bug").OpenPR(number)
+	m := newRobotMetrics()
+
+	// 10 requests every 10 seconds, 2 of them are reserved for the mutations
+	limits := newRateLimits(10, 10*time.Second, 0.2, m)
+	cli := newRateLimitedClient(fake, limits.of("")).(*rateLimitedClient)
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	var slept []time.Duration
+	l := cli.limit.limiter
+	l.now, l.last = func() time.Time { return now }, now
+	l.sleep = func(d time.Duration) {
+		slept = append(slept, d)
+		now = now.Add(d)
+	}
+
+	// the reads use the budget except the reserve
+	for i := 0; i < 8; i++ {
+		cli.GetRepoIssueLabels("owner", "repo1")
+	}
+	assert.Empty(t, slept)
+
+	// the mutations use the reserve
+	assert.True(t, cli.AddPRLabels("owner", "repo1", number, []string{"kind/bug"}))
+	assert.True(t, cli.RemovePRLabels("owner", "repo1", number, []string{"kind/bug"}))
+	assert.Empty(t, slept)
+
+	// the budget is exhausted, the calls wait for it instead of failing
+	assert.True(t, cli.AddPRLabels("owner", "repo1", number, []string{"kind/bug"}))
+	assert.Equal(t, []time.Duration{time.Second}, slept)
+	_, ok := cli.GetRepoIssueLabels("owner", "repo1")
+	assert.True(t, ok)
+	assert.Equal(t, []time.Duration{time.Second, 3 * time.Second}, slept)
+	assert.Equal(t, 2, testutil.CollectAndCount(m.rateLimitWaits, metricsNamespace+"_rate_limit_wait_seconds"))
+	assert.Equal(t, 12, len(fake.Calls()))
+
+	// the reads yield to the mutations waiting
+	l.requests = 8
+	l.waitingMutations = 9
+	assert.Equal(t, 2*time.Second, l.take(priorityRead))
+	assert.Equal(t, time.Duration(0), l.take(priorityMutation))
+	l.waitingMutations = 0
+
+	// the failed call is charged for the retries of the API client
+	l.requests = 10
+	fake.Fail("GetRepoIssueLabels")
+	_, ok = cli.GetRepoIssueLabels("owner", "repo1")
+	assert.False(t, ok)
+	assert.Equal(t, 10.0-requestAttempts, l.requests)
+	fake.Recover("GetRepoIssueLabels")
+
+	// the reads are not starved by the reserve of a small budget
+	small := newRateLimiter(1, time.Second, 0.5)
+	assert.Equal(t, time.Duration(0), small.take(priorityRead))
+
+	// the budget is kept by the credential, the client of a rotated token shares it
+	assert.Same(t, limits.of(""), limits.of(""))
+	assert.NotSame(t, limits.of(""), limits.of("openeuler"))
+
+	// the client is not limited without the budget
+	disabled := newRateLimits(0, time.Hour, 0.1, m)
+	assert.Nil(t, disabled)
+	assert.Nil(t, disabled.of(""))
+	assert.Same(t, fake, newRateLimitedClient(fake, disabled.of("")))
+}
+
+func TestRestClientRateLimit(t *testing.T) {
+	github := newPlatformServer(t, map[string]string{
+		"GET /repos/gh/repo1/issues/1/labels":               `[{"name": "kind/bug"}]`,
+		"DELETE /repos/gh/repo1/issues/1/labels/kind%2Fbug": `[]`,
+		"DELETE /repos/gh/repo1/issues/1/labels/lgtm":       `[]`,
+	})
+	limit := newRateLimits(10, time.Hour, 0.2, nil).of("")
+	cli := newGitHubClient([]byte("token"), github.URL, framework.NewLogger())
+	cli.api.limit = limit
+
+	// each request is charged, e.g. the deletion of each label
+	assert.True(t, cli.RemoveIssueLabels("gh", "repo1", "1", []string{"kind/bug", "lgtm"}))
+	_, ok := cli.GetIssueLabels("gh", "repo1", "1", "")
+	assert.True(t, ok)
+	assert.Equal(t, 3, len(github.requests))
+	assert.InDelta(t, 7, limit.limiter.requests, 0.01)
+}
@@ -0,0 +1,127 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"github.com/opensourceways/robot-framework-lib/config"
+	"github.com/sirupsen/logrus"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// liveConfig is the configmap given to the framework, it holds the current configuration
+// which is swapped when the config file changes. The framework passes it to the handlers,
+// and each event is handled with the configuration current when the event arrives.
+type liveConfig struct {
+	path    string
+	current atomic.Pointer[configuration]
+	log     *logrus.Entry
+	// check checks the reloaded configuration against the flags, it is nil if there is nothing to check
+	check func(c *configuration) error
+
+	// lock serializes the reloads, digest is the digest of the content of the file loaded last
+	lock   sync.Mutex
+	digest [sha256.Size]byte
+}
+
+func newLiveConfig(path string, c *configuration, log *logrus.Entry) *liveConfig {
+	l := &liveConfig{path: path, log: log}
+	l.current.Store(c)
+	if b, err := os.ReadFile(path); err == nil {
+		l.digest = sha256.Sum256(b)
+	}
+
+	return l
+}
+
+// Validate does nothing, the configuration is validated before it is swapped in
+func (l *liveConfig) Validate() error {
+	return nil
+}
+
+func (l *liveConfig) get() *configuration {
+	return l.current.Load()
+}
+
+// reload loads the config file if its content changed, and swaps the configuration in if it is valid.
+// The last good configuration is kept if the new one is invalid, and the invalid file is not loaded
+// again until it changes. It returns true if the configuration is swapped.
+func (l *liveConfig) reload() (bool, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	b, err := os.ReadFile(l.path)
+	if err != nil {
+		return false, err
+	}
+	digest := sha256.Sum256(b)
+	if digest == l.digest {
+		return false, nil
+	}
+	l.digest = digest
+
+	c, problems := loadConfigFile(l.path)
+	if len(problems) != 0 {
+		return false, errors.New(strings.Join(problems, "\n"))
+	}
+	if l.check != nil {
+		if err := l.check(c); err != nil {
+			return false, err
+		}
+	}
+	l.current.Store(c)
+
+	return true, nil
+}
+
+// watch reloads the config file, it is called periodically
+func (l *liveConfig) watch() {
+	swapped, err := l.reload()
+	if err != nil {
+		l.log.WithError(err).Errorf("failed to reload the config file %s, keep the last good config", l.path)
+		return
+	}
+	if swapped {
+		l.log.Infof("reloaded the config file %s", l.path)
+		l.get().warn(l.log)
+	}
+}
+
+// configOf returns the configuration of the configmap passed to the handlers by the framework,
+// it is the configuration of the bot if the configmap is unknown, e.g. nil.
+func (bot *robot) configOf(cnf config.Configmap) *configuration {
+	switch c := cnf.(type) {
+	case *liveConfig:
+		return c.get()
+	case *configuration:
+		if c != nil {
+			return c
+		}
+	}
+
+	return bot.currentConfig()
+}
+
+// currentConfig returns the configuration current at the moment
+func (bot *robot) currentConfig() *configuration {
+	if bot.live != nil {
+		return bot.live.get()
+	}
+
+	return bot.cnf
+}
@@ -0,0 +1,76 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"github.com/opensourceways/robot-framework-lib/framework"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReloadConfig(t *testing.T) {
+	b, err := os.ReadFile(findTestdata(t, "config3.yaml"))
+	assert.Nil(t, err)
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.Nil(t, os.WriteFile(file, b, 0o600))
+
+	cnf, problems := loadConfigFile(file)
+	assert.Nil(t, problems)
+	live := newLiveConfig(file, cnf, framework.NewLogger())
+	bot := &robot{cnf: cnf, live: live}
+	assert.Equal(t, live, bot.GetConfigmap())
+
+	// the file does not change
+	swapped, err := live.reload()
+	assert.False(t, swapped)
+	assert.Nil(t, err)
+
+	// a valid change is swapped in, the events arriving later are handled with it
+	changed := strings.Replace(string(b), "squash_commit_label: stat/needs-squash", "squash_commit_label: needs-squash", 1)
+	assert.Nil(t, os.WriteFile(file, []byte(changed), 0o600))
+	swapped, err = live.reload()
+	assert.True(t, swapped)
+	assert.Nil(t, err)
+	assert.Equal(t, "needs-squash", bot.withConfig(bot.GetConfigmap()).cnf.SquashCommitLabel)
+	// the event being handled keeps the config when it arrived
+	assert.Equal(t, "stat/needs-squash", bot.withConfig(cnf).cnf.SquashCommitLabel)
+
+	// an invalid change is rejected, and the last good config is kept
+	invalid := strings.Replace(changed, "squash_commit_label: needs-squash", "", 1)
+	assert.Nil(t, os.WriteFile(file, []byte(invalid), 0o600))
+	swapped, err = live.reload()
+	assert.False(t, swapped)
+	assert.ErrorContains(t, err, "missing the follow config: squash_commit_label")
+	assert.Equal(t, "needs-squash", live.get().SquashCommitLabel)
+	// it is not loaded again until it changes
+	swapped, err = live.reload()
+	assert.False(t, swapped)
+	assert.Nil(t, err)
+
+	// a change which does not match the flags is rejected as well
+	live.check = (&robotOptions{authMode: authModeGitHubApp}).checkConfig
+	assert.Nil(t, os.WriteFile(file, []byte(changed+"\n"), 0o600))
+	swapped, err = live.reload()
+	assert.False(t, swapped)
+	assert.ErrorContains(t, err, "config_items[0].platform: the repositories must be on github in the github-app auth mode")
+	live.check = nil
+
+	assert.Nil(t, os.Remove(file))
+	_, err = live.reload()
+	assert.NotNil(t, err)
+	assert.Equal(t, "needs-squash", bot.withConfig(nil).cnf.SquashCommitLabel)
+}
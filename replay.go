@@ -0,0 +1,237 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/opensourceways/robot-framework-lib/client"
+	"github.com/opensourceways/robot-framework-lib/framework"
+	"github.com/opensourceways/robot-framework-lib/utils"
+	"github.com/opensourceways/robot-universal-label/fakeclient"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+)
+
+// the header of the event type of the GitCode webhooks
+const headerEventType = "X-GitCode-Event"
+
+// eventTypesByKind maps the object_kind of the payloads to the event types of the webhooks
+var eventTypesByKind = map[string]string{
+	"merge_request": framework.PullRequestEvent,
+	"note":          framework.NoteEvent,
+	"issue":         framework.IssueEvent,
+	"push":          framework.PushEvent,
+}
+
+// replayResponses are the recorded state of the repository, the pull request and the issue of the event,
+// the fake client answers the reads with it, and the mutations change it.
+type replayResponses struct {
+	PRLabels    []string            `json:"pr_labels,omitempty"`
+	IssueLabels []string            `json:"issue_labels,omitempty"`
+	RepoLabels  []string            `json:"repo_labels,omitempty"`
+	Commits     []client.PRCommit   `json:"commits,omitempty"`
+	Comments    []client.PRComment  `json:"comments,omitempty"`
+	Changes     []client.CommitFile `json:"changes,omitempty"`
+	// Permission is true if the commenters and the pushers have the permission of the repository
+	Permission bool `json:"permission,omitempty"`
+	// Failures are the names of the methods which fail, e.g. AddPRLabels
+	Failures []string `json:"failures,omitempty"`
+}
+
+// newReplayClient creates the fake client which holds the repository, the pull request and the issue of the event
+// in the state of the recorded responses, the calls of the methods in the failures fail.
+func newReplayClient(responses *replayResponses, evt *client.GenericEvent) *fakeclient.Client {
+	org, repo, number := utils.GetString(evt.Org), utils.GetString(evt.Repo), utils.GetString(evt.Number)
+	cli := fakeclient.New()
+	r := cli.AddRepo(org, repo, slices.Clone(responses.RepoLabels)...)
+	if responses.Permission {
+		r.Collaborators = []string{utils.GetString(evt.Commenter), utils.GetString(evt.Author)}
+	}
+
+	pr := r.OpenPR(number, responses.Commits...)
+	pr.Labels = slices.Clone(responses.PRLabels)
+	pr.Changes = responses.Changes
+	pr.Comments = responses.Comments
+
+	issue := r.OpenIssue(number, utils.GetString(evt.ID))
+	issue.Labels = slices.Clone(responses.IssueLabels)
+
+	cli.Fail(responses.Failures...)
+
+	return cli
+}
+
+// printCalls prints every call to the client, the calls of the methods in the failures are the failed ones
+func printCalls(out io.Writer, calls []fakeclient.Call, failures []string) {
+	for _, c := range calls {
+		s := make([]string, len(c.Args))
+		for i, a := range c.Args {
+			s[i] = fmt.Sprintf("%q", a)
+		}
+		_, _ = fmt.Fprintf(out, "%s(%s) success=%t\n", c.Method, strings.Join(s, ", "), !slices.Contains(failures, c.Method))
+	}
+}
+
+// replayHandlers holds the handlers registered by the bot, in the same way as the framework
+type replayHandlers struct {
+	issue              framework.GenericHandlerFunc
+	issueComment       framework.GenericHandlerFunc
+	pullRequest        framework.GenericHandlerFunc
+	pullRequestComment framework.GenericHandlerFunc
+	push               framework.GenericHandlerFunc
+}
+
+func (h *replayHandlers) RegisterIssueHandler(fn framework.GenericHandlerFunc) { h.issue = fn }
+
+func (h *replayHandlers) RegisterIssueCommentHandler(fn framework.GenericHandlerFunc) {
+	h.issueComment = fn
+}
+
+func (h *replayHandlers) RegisterPullRequestHandler(fn framework.GenericHandlerFunc) {
+	h.pullRequest = fn
+}
+
+func (h *replayHandlers) RegisterPullRequestCommentHandler(fn framework.GenericHandlerFunc) {
+	h.pullRequestComment = fn
+}
+
+func (h *replayHandlers) RegisterPushEventHandler(fn framework.GenericHandlerFunc) { h.push = fn }
+
+// handlerOf returns the handler of the event as the dispatcher of the framework chooses, or nil if there is none
+func (h *replayHandlers) handlerOf(evt *client.GenericEvent) framework.GenericHandlerFunc {
+	switch utils.GetString(evt.EventType) {
+	case framework.IssueEvent:
+		return h.issue
+	case framework.PullRequestEvent:
+		return h.pullRequest
+	case framework.NoteEvent:
+		switch utils.GetString(evt.CommentKind) {
+		case client.CommentOnIssue:
+			return h.issueComment
+		case client.CommentOnPR:
+			return h.pullRequestComment
+		}
+	case framework.PushEvent:
+		return h.push
+	}
+
+	return nil
+}
+
+// parseEvent parses the webhook payload in the same way as the framework, the event type is
+// taken from the object_kind of the payload if it is empty.
+func parseEvent(payload []byte, eventType string) (*client.GenericEvent, error) {
+	if eventType == "" {
+		var p struct {
+			ObjectKind string `json:"object_kind"`
+		}
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return nil, err
+		}
+		if eventType = eventTypesByKind[p.ObjectKind]; eventType == "" {
+			return nil, errors.New("unknown object_kind of the payload: " + p.ObjectKind)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(payload))
+	req.Header.Set(headerEventType, eventType)
+	evt := client.NewGenericEvent(httptest.NewRecorder(), req, framework.NewLogger())
+	if evt.EventType == nil {
+		return nil, errors.New("unsupported event type: " + eventType)
+	}
+
+	return evt, nil
+}
+
+// replayEvent runs the event through the handlers registered by the bot, it returns false if no handler handles the event
+func replayEvent(bot *robot, evt *client.GenericEvent) bool {
+	h := &replayHandlers{}
+	bot.RegisterEventHandler(h)
+
+	fn := h.handlerOf(evt)
+	if fn == nil {
+		return false
+	}
+	fn(evt, bot.cnf, bot.log.WithFields(*evt.CollectLoggingFields()))
+
+	return true
+}
+
+// replayWebhook runs a saved webhook payload through the handlers of the bot against a fake client
+// answering with the recorded responses, and prints every API call the bot makes. It returns the exit code.
+//
+//	robot-universal-label replay --config-file=config.yaml [--responses=responses.json] [--event-type="Note Hook"] payload.json
+func replayWebhook(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.SetOutput(out)
+	configFile := fs.String("config-file", "", "Path to the config file.")
+	responsesFile := fs.String("responses", "", "Path to the json file of the recorded responses of the reads.")
+	eventType := fs.String("event-type", "", "The event type of the payload, e.g. Note Hook. default: by object_kind")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *configFile == "" || fs.NArg() != 1 {
+		_, _ = fmt.Fprintln(out,
+			"usage: replay --config-file=config.yaml [--responses=responses.json] [--event-type=\"Note Hook\"] payload.json")
+		return 2
+	}
+
+	cnf, problems := loadConfigFile(*configFile)
+	if len(problems) != 0 {
+		_, _ = fmt.Fprintln(out, strings.Join(problems, "\n"))
+		return 1
+	}
+
+	var responses replayResponses
+	if *responsesFile != "" {
+		b, err := os.ReadFile(*responsesFile)
+		if err == nil {
+			err = json.Unmarshal(b, &responses)
+		}
+		if err != nil {
+			_, _ = fmt.Fprintf(out, "%s: %v\n", *responsesFile, err)
+			return 1
+		}
+	}
+
+	payload, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		_, _ = fmt.Fprintln(out, err)
+		return 1
+	}
+	evt, err := parseEvent(payload, *eventType)
+	if err != nil {
+		_, _ = fmt.Fprintf(out, "%s: %v\n", fs.Arg(0), err)
+		return 1
+	}
+
+	cli := newReplayClient(&responses, evt)
+	bot := &robot{cli: cli, cnf: cnf, log: framework.NewLogger().WithField("component", component), changes: newPRChanges()}
+	handled := replayEvent(bot, evt)
+	printCalls(out, cli.Calls(), responses.Failures)
+	if !handled {
+		_, _ = fmt.Fprintf(out, "no handler for the event %s\n", utils.GetString(evt.EventType))
+	}
+
+	return 0
+}
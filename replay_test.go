@@ -0,0 +1,67 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"github.com/opensourceways/robot-framework-lib/framework"
+	"github.com/opensourceways/robot-framework-lib/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReplayWebhook(t *testing.T) {
+	config := "--config-file=" + findTestdata(t, "config3.yaml")
+	responses := "--responses=" + findTestdata(t, "replay_responses.json")
+
+	var out strings.Builder
+	assert.Equal(t, 0, replayWebhook([]string{config, responses, findTestdata(t, "replay_pr_create.json")}, &out))
+	assert.Equal(t, `GetPullRequestCommits("ibforuorg", "test1", "4") success=true
+GetPullRequestLabels("ibforuorg", "test1", "4") success=true
+AddPRLabels("ibforuorg", "test1", "4", ["stat/needs-squash"]) success=true
+`, out.String())
+
+	out.Reset()
+	assert.Equal(t, 0, replayWebhook([]string{config, responses, findTestdata(t, "replay_pr_note.json")}, &out))
+	assert.Equal(t, `GetRepoIssueLabels("ibforuorg", "test1") success=true
+CheckPermission("ibforuorg", "test1", "****") success=false
+GetPullRequestLabels("ibforuorg", "test1", "4") success=true
+`, out.String())
+
+	out.Reset()
+	assert.Equal(t, 0, replayWebhook([]string{config, "--event-type=Push Hook", findTestdata(t, "replay_pr_note.json")}, &out))
+	assert.Equal(t, "no handler for the event Push Hook\n", out.String())
+
+	out.Reset()
+	assert.Equal(t, 1, replayWebhook([]string{config, "--event-type=Tag Hook", findTestdata(t, "replay_pr_note.json")}, &out))
+	assert.Contains(t, out.String(), "unsupported event type: Tag Hook")
+
+	out.Reset()
+	assert.Equal(t, 2, replayWebhook([]string{config}, &out))
+	assert.Contains(t, out.String(), "usage: replay")
+}
+
+func TestParseEvent(t *testing.T) {
+	payload, err := os.ReadFile(findTestdata(t, "replay_pr_note.json"))
+	assert.Nil(t, err)
+
+	evt, err := parseEvent(payload, "")
+	assert.Nil(t, err)
+	assert.Equal(t, framework.NoteEvent, utils.GetString(evt.EventType))
+	assert.Equal(t, "/lgtm\n/approve", utils.GetString(evt.Comment))
+
+	_, err = parseEvent([]byte(`{"object_kind": "tag_push"}`), "")
+	assert.EqualError(t, err, "unknown object_kind of the payload: tag_push")
+}
@@ -0,0 +1,69 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+const (
+	// commandReportMarker is a hidden mark in the report comment, it is used to find the previous report.
+	commandReportMarker = "<!-- robot-universal-label: command report -->"
+
+	// defaultCommentCommandReport lays out the feedback messages of the report one by one.
+	defaultCommentCommandReport = `{{range $i, $s := .Sections}}{{if $i}}
+
+---
+
+{{end}}{{$s}}{{end}}`
+)
+
+// commandReport collects all outcomes of a label command comment,
+// so that the bot responds to the comment only once.
+// Besides the fields of commentData, the template of comment_command_report can refer to
+// the labels of each outcome and the rendered feedback messages of the failed outcomes.
+type commandReport struct {
+	commentData
+	ConflictLabels []string
+	MissingLabels  []string
+	Added          []string
+	Removed        []string
+	AddFailed      []string
+	RemoveFailed   []string
+	// Sections holds the feedback messages of the failed outcomes in order,
+	// they are rendered in the same locale as the report.
+	Sections []string
+
+	failures []reportFailure
+	// commenter, commentID and comment are the raw command comment, they are recorded in the audit log
+	commenter string
+	commentID string
+	comment   string
+}
+
+// reportFailure is a failed outcome, it is rendered by the comment template of name with data.
+type reportFailure struct {
+	name string
+	data *commentData
+}
+
+func (r *commandReport) fail(name string, data *commentData) {
+	r.failures = append(r.failures, reportFailure{name: name, data: data})
+}
+
+// failed returns true if any outcome of the command is failed.
+func (r *commandReport) failed() bool {
+	return len(r.failures) != 0
+}
+
+// handled returns true if the command has done something or failed to do.
+func (r *commandReport) handled() bool {
+	return r.failed() || len(r.Added) != 0 || len(r.Removed) != 0
+}
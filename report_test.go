@@ -0,0 +1,68 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRenderCommandReport(t *testing.T) {
+	report := &commandReport{
+		commentData:   commentData{Commenter: commenter},
+		MissingLabels: []string{"kind/a"},
+		Removed:       []string{"sig/b"},
+	}
+	assert.Equal(t, true, report.handled())
+	assert.Equal(t, false, report.failed())
+	report.fail(templateCommentAddNotExistLabel, report.withLabels(report.MissingLabels))
+	assert.Equal(t, true, report.failed())
+
+	testCases := []struct {
+		desc string
+		in   string
+		out  string
+		fail bool
+	}{
+		{
+			"the default template",
+			"",
+			"missing kind/a",
+			false,
+		},
+		{
+			"a structured template",
+			"{{.Commenter}}: removed {{range .Removed}}`{{.}}` {{end}}, missing {{len .MissingLabels}}",
+			commenter + ": removed `sig/b` , missing 1",
+			false,
+		},
+		{
+			"a template refers to the unknown field",
+			"{{.Unknown}}",
+			"",
+			true,
+		},
+	}
+	for i := range testCases {
+		t.Run(testCases[i].desc, func(t *testing.T) {
+			cnf := &configuration{CommentTemplates: CommentTemplates{
+				CommentAddNotExistLabel: "missing {{join .Labels \", \"}}",
+				CommentCommandReport:    testCases[i].in,
+			}}
+			got, err := cnf.renderReport(nil, report)
+			assert.Equal(t, testCases[i].fail, err != nil)
+			assert.Equal(t, testCases[i].out, got)
+		})
+	}
+}
@@ -14,14 +14,12 @@
 package main
 
 import (
-	"fmt"
 	"github.com/opensourceways/robot-framework-lib/client"
 	"github.com/opensourceways/robot-framework-lib/config"
 	"github.com/opensourceways/robot-framework-lib/framework"
 	"github.com/opensourceways/robot-framework-lib/utils"
 	"github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/util/sets"
-	"strings"
 )
 
 // iClient is an interface that defines methods for client-side interactions
@@ -37,26 +35,112 @@ type iClient interface {
 	CheckIfPRSourceCodeUpdateEvent(evt *client.GenericEvent) (yes bool)
 	GetPullRequestCommits(org, repo, number string) (result []client.PRCommit, success bool)
 	GetPullRequestLabels(org, repo, number string) (result []string, success bool)
-	GetIssueLabels(org, issueID string) (result []string, success bool)
+	// GetIssueLabels gets the labels of the issue, which is addressed by the number or the id depending on the platform
+	GetIssueLabels(org, repo, number, issueID string) (result []string, success bool)
 	GetRepoIssueLabels(org, repo string) (result []string, success bool)
 	CheckPermission(org, repo, username string) (pass, success bool)
+	// CreatePRCommentReaction reacts to a comment of a pull request with an emoji
+	CreatePRCommentReaction(org, repo, commentID, reaction string) (success bool)
+	CreateIssueCommentReaction(org, repo, commentID, reaction string) (success bool)
+	// ListBotPRComments lists the comments of the pull request which the bot itself has created
+	ListBotPRComments(org, repo, number string) (result []client.PRComment, success bool)
+	UpdatePRComment(org, repo, commentID, comment string) (success bool)
+	GetPullRequestChanges(org, repo, number string) (result []client.CommitFile, success bool)
 }
 
 type robot struct {
 	cli iClient
 	cnf *configuration
 	log *logrus.Entry
+	// changes remembers the changes of the open PRs, it is used by the conditions of clearing labels
+	changes *prChanges
+	// auditor records the label mutations, it is nil if they are not recorded
+	auditor auditSink
+	// metrics is nil if the metrics are not collected
+	metrics *robotMetrics
+	// dryRunAll intercepts the mutations of all the repositories
+	dryRunAll bool
+	// live holds the current configuration reloaded from the config file, it is nil if the config is not reloaded
+	live *liveConfig
+	// rotating is the client of the current token, clientOf creates the client of a rotated token
+	// of the credential, which is empty for the token of the bot
+	rotating *rotatingClient
+	clientOf func(credential string, token []byte) iClient
+	// credentials are the clients of the named credentials which the config items reference
+	credentials map[string]*rotatingClient
+	// cache caches the reads of the clients, it is nil if they are not cached
+	cache *readCache
 }
 
-func newRobot(c *configuration, token []byte) *robot {
+func newRobot(live *liveConfig, token []byte, opt *robotOptions) *robot {
 	logger := framework.NewLogger().WithField("component", component)
-	return &robot{cli: client.NewClient(token, logger), cnf: c, log: logger}
+	bot := &robot{
+		cnf:       live.get(),
+		live:      live,
+		log:       logger,
+		changes:   newBoundedPRChanges(opt.prChangesSize, opt.prChangesTTL),
+		auditor:   opt.audit,
+		metrics:   newRobotMetrics(),
+		dryRunAll: opt.dryRun,
+	}
+	bot.cache = newReadCache(opt.cacheTTL, bot.metrics)
+	// each credential has its own budget, the clients of its rotated tokens share it
+	limits := newRateLimits(opt.rateLimit, opt.rateLimitInterval, opt.rateLimitReserve, bot.metrics)
+	bot.clientOf = func(credential string, token []byte) iClient {
+		return newPlatformClient(token, opt.apiURLs, limits.of(credential), bot.platformOf, bot.platforms, logger)
+	}
+	if opt.app != nil {
+		// the installation of each org has its own budget, the credential names are file names without a slash
+		bot.rotating = newRotatingClient(newAppClient(opt.app, func(org string, token []byte) iClient {
+			cli := newGitHubClient(token, opt.apiURLs.github, logger)
+			cli.appID = opt.app.id
+			cli.api.limit = limits.of("app/" + org)
+			return cli
+		}, logger))
+	} else {
+		bot.rotating = newRotatingClient(bot.clientOf("", token))
+	}
+	bot.cli = bot.wrapClient(bot.rotating)
+
+	// each named credential calls the API with its own token, so it has its own rate-limit budget
+	bot.credentials = make(map[string]*rotatingClient, len(opt.credentialTokens))
+	for name, token := range opt.credentialTokens {
+		bot.credentials[name] = newRotatingClient(bot.clientOf(name, token))
+	}
+
+	return bot
 }
 
+// wrapClient wraps the client of a token with the dry-run mode, the instrumentation and the cache
+func (bot *robot) wrapClient(cli iClient) iClient {
+	// the intercepted mutations do not call the platform, so they are not observed as the calls
+	instrumented := &instrumentedClient{iClient: cli, metrics: bot.metrics}
+	var wrapped iClient = &dryRunClient{iClient: instrumented, dryRun: bot.dryRun, log: bot.log}
+	if bot.cache == nil {
+		return wrapped
+	}
+
+	// the cached reads do not call the platform, so they are not observed
+	return &cachingClient{iClient: wrapped, cache: bot.cache}
+}
+
+// GetConfigmap returns the configmap which the framework passes to the handlers
 func (bot *robot) GetConfigmap() config.Configmap {
+	if bot.live != nil {
+		return bot.live
+	}
 	return bot.cnf
 }
 
+// withConfig returns a copy of the bot which handles an event with the configuration of the configmap,
+// so that the configuration does not change while the event is handled.
+func (bot *robot) withConfig(cnf config.Configmap) *robot {
+	b := *bot
+	b.cnf = bot.configOf(cnf)
+
+	return &b
+}
+
 func (bot *robot) RegisterEventHandler(p framework.HandlerRegister) {
 	p.RegisterPullRequestHandler(bot.handlePullRequestEvent)
 	p.RegisterIssueCommentHandler(bot.handleIssueCommentEvent)
@@ -73,37 +157,66 @@ const (
 
 func (bot *robot) handlePullRequestEvent(evt *client.GenericEvent, cnf config.Configmap, logger *logrus.Entry) {
 	org, repo, number := utils.GetString(evt.Org), utils.GetString(evt.Repo), utils.GetString(evt.Number)
+	bot, ok := bot.withConfig(cnf).withCredential(org, repo)
+	if !ok {
+		return
+	}
+	bot, span := bot.startEventSpan("handlePullRequestEvent", eventTypePullRequest, evt)
+	defer span.End()
 	repoCnf := bot.cnf.getRepoConfig(org, repo)
+	bot.metrics.observeEvent(eventTypePullRequest, org, repo, repoCnf != nil)
 	// If the specified repository not match any repository  in the repoConfig list, it logs the warning and returns
 	if repoCnf == nil {
 		logger.Warning(logWarningMessage + org + "/" + repo)
 		return
 	}
 
+	// The changes of the PR are not needed any more
+	if state := utils.GetString(evt.State); state == "closed" || state == "merged" {
+		bot.changes.forget(prKey(org, repo, number))
+		return
+	}
+
 	// Checks if PR is firstly created or PR source code is updated
 	if !(bot.cli.CheckIfPRCreateEvent(evt) || bot.cli.CheckIfPRSourceCodeUpdateEvent(evt)) {
 		return
 	}
 
+	if bot.cli.CheckIfPRCreateEvent(evt) {
+		bot.recordPRChanges(org, repo, number, repoCnf)
+	}
+
 	bot.handleSquashLabel(org, repo, number, repoCnf)
 	bot.clearLabelWhenPRSourceCodeUpdated(org, repo, number, repoCnf, evt)
 }
 
 func (bot *robot) handleIssueCommentEvent(evt *client.GenericEvent, cnf config.Configmap, logger *logrus.Entry) {
 	org, repo, number := utils.GetString(evt.Org), utils.GetString(evt.Repo), utils.GetString(evt.Number)
+	bot, ok := bot.withConfig(cnf).withCredential(org, repo)
+	if !ok {
+		return
+	}
+	bot, span := bot.startEventSpan("handleIssueCommentEvent", eventTypeIssueComment, evt)
+	defer span.End()
 	repoCnf := bot.cnf.getRepoConfig(org, repo)
+	bot.metrics.observeEvent(eventTypeIssueComment, org, repo, repoCnf != nil)
 	// If the specified repository not match any repository  in the repoConfig list, it logs the warning and returns
 	if repoCnf == nil {
 		logger.Warning(logWarningMessage + org + "/" + repo)
 		return
 	}
 
-	commenter := utils.GetString(evt.Commenter)
-	commenter = strings.ReplaceAll(bot.cnf.UserMarkFormat, bot.cnf.PlaceholderCommenter, commenter)
+	data := bot.newCommentData(repoCnf, org, repo, number, utils.GetString(evt.Commenter), utils.GetString(evt.HtmlURL))
+	fb := feedback{repoCnf: repoCnf, commentID: utils.GetString(evt.CommentID)}
+	report := &commandReport{commentData: data, commenter: utils.GetString(evt.Commenter),
+		commentID: utils.GetString(evt.CommentID), comment: utils.GetString(evt.Comment)}
+	defer bot.sendIssueReport(org, repo, number, fb, report)
+
 	addLabels, removeLabels := matchLabels(utils.GetString(evt.Comment))
+	bot.metrics.observeCommands(org, repo, addLabels, removeLabels)
 	if conflict, conflictLabels := checkIntersection(addLabels, removeLabels); conflict {
-		comment := fmt.Sprintf(bot.cnf.CommentLabelCommandConflict, commenter, conflictLabels)
-		bot.cli.CreateIssueComment(org, repo, number, comment)
+		report.ConflictLabels = conflictLabels
+		report.fail(templateCommentLabelCommandConflict, data.withLabels(conflictLabels))
 		return
 	}
 
@@ -113,33 +226,48 @@ func (bot *robot) handleIssueCommentEvent(evt *client.GenericEvent, cnf config.C
 	missingLabels := addLabelSet.Difference(repoLabelSet).UnsortedList()
 	pass, _ := bot.cli.CheckPermission(org, repo, utils.GetString(evt.Commenter))
 	if !pass && len(missingLabels) != 0 {
-		bot.cli.CreateIssueComment(org, repo, number,
-			fmt.Sprintf(bot.cnf.CommentAddNotExistLabel, commenter, strings.Join(missingLabels, ", ")))
+		report.MissingLabels = missingLabels
+		report.fail(templateCommentAddNotExistLabel, data.withLabels(missingLabels))
+	}
+	// The command is not executed at all, if it adds the missing labels
+	if report.failed() {
 		return
 	}
 
 	removeLabelSet := sets.New[string](removeLabels...)
-	issueLabels, _ := bot.cli.GetIssueLabels(org, utils.GetString(evt.ID))
+	issueLabels, _ := bot.cli.GetIssueLabels(org, repo, number, utils.GetString(evt.ID))
 	issueLabelSet := sets.New[string](issueLabels...)
-	bot.addIssueLabels(org, repo, number, commenter, addLabelSet.Difference(issueLabelSet).UnsortedList())
-	bot.removeIssueLabels(org, repo, number, commenter, issueLabelSet.Intersection(removeLabelSet).UnsortedList())
+	bot.addIssueLabels(org, repo, number, addLabelSet.Difference(issueLabelSet).UnsortedList(), report)
+	bot.removeIssueLabels(org, repo, number, issueLabelSet.Intersection(removeLabelSet).UnsortedList(), report)
 }
 
 func (bot *robot) handlePullRequestCommentEvent(evt *client.GenericEvent, cnf config.Configmap, logger *logrus.Entry) {
 	org, repo, number := utils.GetString(evt.Org), utils.GetString(evt.Repo), utils.GetString(evt.Number)
+	bot, ok := bot.withConfig(cnf).withCredential(org, repo)
+	if !ok {
+		return
+	}
+	bot, span := bot.startEventSpan("handlePullRequestCommentEvent", eventTypePullRequestComment, evt)
+	defer span.End()
 	repoCnf := bot.cnf.getRepoConfig(org, repo)
+	bot.metrics.observeEvent(eventTypePullRequestComment, org, repo, repoCnf != nil)
 	// If the specified repository not match any repository  in the repoConfig list, it logs the warning and returns
 	if repoCnf == nil {
 		logger.Warning(logWarningMessage + org + "/" + repo)
 		return
 	}
 
-	commenter := utils.GetString(evt.Commenter)
-	commenter = strings.ReplaceAll(bot.cnf.UserMarkFormat, bot.cnf.PlaceholderCommenter, commenter)
+	data := bot.newCommentData(repoCnf, org, repo, number, utils.GetString(evt.Commenter), utils.GetString(evt.HtmlURL))
+	fb := feedback{repoCnf: repoCnf, commentID: utils.GetString(evt.CommentID)}
+	report := &commandReport{commentData: data, commenter: utils.GetString(evt.Commenter),
+		commentID: utils.GetString(evt.CommentID), comment: utils.GetString(evt.Comment)}
+	defer bot.sendPRReport(org, repo, number, fb, report)
+
 	addLabels, removeLabels := matchLabels(utils.GetString(evt.Comment))
+	bot.metrics.observeCommands(org, repo, addLabels, removeLabels)
 	if conflict, conflictLabels := checkIntersection(addLabels, removeLabels); conflict {
-		comment := fmt.Sprintf(bot.cnf.CommentLabelCommandConflict, commenter, conflictLabels)
-		bot.cli.CreatePRComment(org, repo, number, comment)
+		report.ConflictLabels = conflictLabels
+		report.fail(templateCommentLabelCommandConflict, data.withLabels(conflictLabels))
 		return
 	}
 
@@ -149,14 +277,17 @@ func (bot *robot) handlePullRequestCommentEvent(evt *client.GenericEvent, cnf co
 	missingLabels := addLabelSet.Difference(repoLabelSet).UnsortedList()
 	pass, _ := bot.cli.CheckPermission(org, repo, utils.GetString(evt.Commenter))
 	if !pass && len(missingLabels) != 0 {
-		bot.cli.CreatePRComment(org, repo, number,
-			fmt.Sprintf(bot.cnf.CommentAddNotExistLabel, commenter, strings.Join(missingLabels, ", ")))
+		report.MissingLabels = missingLabels
+		report.fail(templateCommentAddNotExistLabel, data.withLabels(missingLabels))
+	}
+	// The command is not executed at all, if it adds the missing labels
+	if report.failed() {
 		return
 	}
 
 	removeLabelSet := sets.New[string](removeLabels...)
 	prLabels, _ := bot.cli.GetPullRequestLabels(org, repo, number)
 	prLabelSet := sets.New[string](prLabels...)
-	bot.addPRLabels(org, repo, number, commenter, addLabelSet.Difference(prLabelSet).UnsortedList())
-	bot.removePRLabels(org, repo, number, commenter, prLabelSet.Intersection(removeLabelSet).UnsortedList())
+	bot.addPRLabels(org, repo, number, addLabelSet.Difference(prLabelSet).UnsortedList(), report)
+	bot.removePRLabels(org, repo, number, prLabelSet.Intersection(removeLabelSet).UnsortedList(), report)
 }
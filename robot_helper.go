@@ -14,8 +14,8 @@
 package main
 
 import (
-	"fmt"
 	"github.com/opensourceways/robot-framework-lib/client"
+	"github.com/opensourceways/robot-framework-lib/utils"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"net/url"
 	"slices"
@@ -25,18 +25,24 @@ import (
 func (bot *robot) handleSquashLabel(org, repo, number string, repoCnf *repoConfig) {
 	commits, success := bot.cli.GetPullRequestCommits(org, repo, number)
 	if !success {
-		bot.cli.CreatePRComment(org, repo, number, bot.cnf.CommentCommandTrigger)
+		bot.cli.CreatePRComment(org, repo, number,
+			bot.comment(repoCnf, templateCommentCommandTrigger, bot.newCommentData(repoCnf, org, repo, number, "", "")))
 		return
 	}
 
 	if repoCnf.UnableCheckingSquash == false {
+		squashLabel := bot.cnf.squashCommitLabel(repoCnf)
 		prLabels, _ := bot.cli.GetPullRequestLabels(org, repo, number)
-		if uint(len(commits)) > repoCnf.CommitsThreshold && !slices.Contains(prLabels, bot.cnf.SquashCommitLabel) {
-			bot.cli.AddPRLabels(org, repo, number, []string{bot.cnf.SquashCommitLabel})
+		if uint(len(commits)) > repoCnf.CommitsThreshold && !slices.Contains(prLabels, squashLabel) {
+			success := bot.cli.AddPRLabels(org, repo, number, []string{squashLabel})
+			bot.audit(auditRecord{Org: org, Repo: repo, Number: number, Target: auditTargetPR, Action: auditActionAdd,
+				Labels: []string{squashLabel}, Trigger: auditTriggerSquash, Success: success})
 		}
 
-		if uint(len(commits)) <= repoCnf.CommitsThreshold && slices.Contains(prLabels, bot.cnf.SquashCommitLabel) {
-			bot.cli.RemovePRLabels(org, repo, number, []string{url.QueryEscape(bot.cnf.SquashCommitLabel)})
+		if uint(len(commits)) <= repoCnf.CommitsThreshold && slices.Contains(prLabels, squashLabel) {
+			success := bot.cli.RemovePRLabels(org, repo, number, []string{url.QueryEscape(squashLabel)})
+			bot.audit(auditRecord{Org: org, Repo: repo, Number: number, Target: auditTargetPR, Action: auditActionRemove,
+				Labels: []string{squashLabel}, Trigger: auditTriggerSquash, Success: success})
 		}
 	}
 }
@@ -45,11 +51,13 @@ func (bot *robot) clearLabelWhenPRSourceCodeUpdated(org, repo, number string, re
 	if !bot.cli.CheckIfPRSourceCodeUpdateEvent(evt) {
 		return
 	}
+	// The changes are recorded on every push, so that the next push is compared with this one
+	changes := bot.recordPRChanges(org, repo, number, repoCnf)
 
-	clearLabelSet := sets.New[string](repoCnf.ClearLabels...)
-	if clearLabelSet.Len() == 0 && repoCnf.ClearLabelsRegexp == nil {
+	if !repoCnf.hasClearLabelsRules() {
 		return
 	}
+	clearLabelSet := sets.New[string](repoCnf.ClearLabels...)
 
 	prLabels, _ := bot.cli.GetPullRequestLabels(org, repo, number)
 	if len(prLabels) == 0 {
@@ -57,7 +65,7 @@ func (bot *robot) clearLabelWhenPRSourceCodeUpdated(org, repo, number string, re
 	}
 
 	for _, l := range prLabels {
-		if repoCnf.ClearLabelsRegexp != nil && repoCnf.ClearLabelsRegexp.MatchString(l) {
+		if repoCnf.matchClearLabelsPatterns(l) {
 			clearLabelSet.Insert(l)
 		}
 	}
@@ -68,60 +76,204 @@ func (bot *robot) clearLabelWhenPRSourceCodeUpdated(org, repo, number string, re
 		return
 	}
 
-	if bot.cli.RemovePRLabels(org, repo, number, clearLabels) {
-		comment := fmt.Sprintf(bot.cnf.CommentRemoveLabelsWhenPRSourceCodeUpdated, strings.Join(clearLabels, ", "))
+	if clearLabels = repoCnf.filterClearLabels(clearLabels, changes); len(clearLabels) == 0 {
+		bot.log.Infof("keep the labels of %s/%s/%s, the push does not change what they depend on", org, repo, number)
+		return
+	}
+
+	// The pusher is the user who triggers the event of the source update
+	if pusher := utils.GetString(evt.Author); bot.trustPusher(org, repo, pusher, repoCnf) {
+		data := bot.newCommentData(repoCnf, org, repo, number, pusher, utils.GetString(evt.HtmlURL))
+		comment := bot.comment(repoCnf, templateCommentKeepLabelsForTrustedPusher, data.withLabels(clearLabels))
+		bot.cli.CreatePRComment(org, repo, number, comment)
+		return
+	}
+
+	success := bot.cli.RemovePRLabels(org, repo, number, clearLabels)
+	bot.audit(auditRecord{Org: org, Repo: repo, Number: number, Target: auditTargetPR, Action: auditActionRemove,
+		Labels: clearLabels, Actor: utils.GetString(evt.Author), Trigger: auditTriggerSourceUpdate, Success: success})
+	if success {
+		data := bot.newCommentData(repoCnf, org, repo, number, "", utils.GetString(evt.HtmlURL))
+		comment := bot.comment(repoCnf, templateCommentRemoveLabelsWhenPRSourceCodeUpdated, data.withLabels(clearLabels))
 		bot.cli.CreatePRComment(org, repo, number, comment)
 	}
 }
 
-func (bot *robot) addIssueLabels(org, repo, number, commenter string, addLabels []string) {
+// trustPusher returns true if the pushes of the user do not lead to remove the labels of the PR
+func (bot *robot) trustPusher(org, repo, pusher string, repoCnf *repoConfig) bool {
+	if pusher == "" {
+		return false
+	}
+
+	if slices.ContainsFunc(repoCnf.TrustedPushers, func(u string) bool { return strings.EqualFold(u, pusher) }) {
+		return true
+	}
+
+	if !repoCnf.TrustCollaborators {
+		return false
+	}
+	pass, success := bot.cli.CheckPermission(org, repo, pusher)
+
+	return success && pass
+}
+
+const (
+	feedbackModeComment  = "comment"
+	feedbackModeReaction = "reaction"
+	feedbackModeBoth     = "both"
+	feedbackModeNone     = "none"
+
+	reactionSuccess = "+1"
+	reactionFailure = "confused"
+)
+
+// feedback indicates how to respond to the comment which triggered a label command.
+type feedback struct {
+	repoCnf   *repoConfig
+	commentID string
+}
+
+func (f feedback) withComment() bool {
+	mode := f.repoCnf.FeedbackMode
+	return mode == feedbackModeComment || mode == feedbackModeBoth || mode == ""
+}
+
+func (f feedback) withReaction() bool {
+	mode := f.repoCnf.FeedbackMode
+	return (mode == feedbackModeReaction || mode == feedbackModeBoth) && f.commentID != ""
+}
+
+func reactionOf(success bool) string {
+	if success {
+		return reactionSuccess
+	}
+	return reactionFailure
+}
+
+// sendPRReport responds to a label command comment of the pull request with the report of the command.
+func (bot *robot) sendPRReport(org, repo, number string, fb feedback, report *commandReport) {
+	if !report.handled() {
+		return
+	}
+
+	if fb.withReaction() {
+		bot.cli.CreatePRCommentReaction(org, repo, fb.commentID, reactionOf(!report.failed()))
+	}
+	if !fb.withComment() || !report.failed() {
+		return
+	}
+
+	comment, err := bot.cnf.renderReport(fb.repoCnf, report)
+	if err != nil {
+		bot.log.WithError(err).Error("failed to render the command report")
+		return
+	}
+	comment += "\n\n" + commandReportMarker
+
+	if fb.repoCnf.EditPreviousFeedback {
+		if id := bot.findPreviousReport(org, repo, number); id != "" && bot.cli.UpdatePRComment(org, repo, id, comment) {
+			return
+		}
+	}
+	bot.cli.CreatePRComment(org, repo, number, comment)
+}
+
+// findPreviousReport returns the id of the latest report comment of the pull request, or empty if there is none.
+func (bot *robot) findPreviousReport(org, repo, number string) string {
+	comments, _ := bot.cli.ListBotPRComments(org, repo, number)
+	for i := len(comments) - 1; i >= 0; i-- {
+		if strings.Contains(comments[i].Body, commandReportMarker) {
+			return comments[i].ID
+		}
+	}
+
+	return ""
+}
+
+// sendIssueReport responds to a label command comment of the issue with the report of the command.
+func (bot *robot) sendIssueReport(org, repo, number string, fb feedback, report *commandReport) {
+	if !report.handled() {
+		return
+	}
+
+	if fb.withReaction() {
+		bot.cli.CreateIssueCommentReaction(org, repo, fb.commentID, reactionOf(!report.failed()))
+	}
+	if !fb.withComment() || !report.failed() {
+		return
+	}
+
+	comment, err := bot.cnf.renderReport(fb.repoCnf, report)
+	if err != nil {
+		bot.log.WithError(err).Error("failed to render the command report")
+		return
+	}
+	comment += "\n\n" + commandReportMarker
+	bot.cli.CreateIssueComment(org, repo, number, comment)
+}
+
+func (bot *robot) addIssueLabels(org, repo, number string, addLabels []string, report *commandReport) {
 	if len(addLabels) == 0 {
 		return
 	}
 
 	success := bot.cli.AddIssueLabels(org, repo, number, addLabels)
-	if !success {
-		comment := fmt.Sprintf(bot.cnf.CommentUpdateLabelFailed, commenter, strings.Join(addLabels, ", "))
-		bot.cli.CreateIssueComment(org, repo, number, comment)
+	bot.audit(report.auditRecord(auditTargetIssue, auditActionAdd, addLabels, success))
+	if success {
+		report.Added = append(report.Added, addLabels...)
+		return
 	}
+	report.AddFailed = append(report.AddFailed, addLabels...)
+	report.fail(templateCommentUpdateLabelFailed, report.withLabels(addLabels))
 }
 
-func (bot *robot) removeIssueLabels(org, repo, number, commenter string, removeLabels []string) {
+func (bot *robot) removeIssueLabels(org, repo, number string, removeLabels []string, report *commandReport) {
 	if len(removeLabels) == 0 {
 		return
 	}
+	escapedLabels := make([]string, len(removeLabels))
 	for i := 0; i < len(removeLabels); i++ {
-		removeLabels[i] = url.QueryEscape(removeLabels[i])
+		escapedLabels[i] = url.QueryEscape(removeLabels[i])
 	}
-	success := bot.cli.RemoveIssueLabels(org, repo, number, removeLabels)
-	if !success {
-		comment := fmt.Sprintf(bot.cnf.CommentUpdateLabelFailed, commenter, strings.Join(removeLabels, ", "))
-		bot.cli.CreateIssueComment(org, repo, number, comment)
+	success := bot.cli.RemoveIssueLabels(org, repo, number, escapedLabels)
+	bot.audit(report.auditRecord(auditTargetIssue, auditActionRemove, removeLabels, success))
+	if success {
+		report.Removed = append(report.Removed, removeLabels...)
+		return
 	}
+	report.RemoveFailed = append(report.RemoveFailed, removeLabels...)
+	report.fail(templateCommentUpdateLabelFailed, report.withLabels(removeLabels))
 }
 
-func (bot *robot) addPRLabels(org, repo, number, commenter string, addLabels []string) {
+func (bot *robot) addPRLabels(org, repo, number string, addLabels []string, report *commandReport) {
 	if len(addLabels) == 0 {
 		return
 	}
 
 	success := bot.cli.AddPRLabels(org, repo, number, addLabels)
-	if !success {
-		comment := fmt.Sprintf(bot.cnf.CommentUpdateLabelFailed, commenter, strings.Join(addLabels, ", "))
-		bot.cli.CreatePRComment(org, repo, number, comment)
+	bot.audit(report.auditRecord(auditTargetPR, auditActionAdd, addLabels, success))
+	if success {
+		report.Added = append(report.Added, addLabels...)
+		return
 	}
+	report.AddFailed = append(report.AddFailed, addLabels...)
+	report.fail(templateCommentUpdateLabelFailed, report.withLabels(addLabels))
 }
 
-func (bot *robot) removePRLabels(org, repo, number, commenter string, removeLabels []string) {
+func (bot *robot) removePRLabels(org, repo, number string, removeLabels []string, report *commandReport) {
 	if len(removeLabels) == 0 {
 		return
 	}
+	escapedLabels := make([]string, len(removeLabels))
 	for i := 0; i < len(removeLabels); i++ {
-		removeLabels[i] = url.QueryEscape(removeLabels[i])
+		escapedLabels[i] = url.QueryEscape(removeLabels[i])
 	}
-	success := bot.cli.RemovePRLabels(org, repo, number, removeLabels)
-	if !success {
-		comment := fmt.Sprintf(bot.cnf.CommentUpdateLabelFailed, commenter, strings.Join(removeLabels, ", "))
-		bot.cli.CreatePRComment(org, repo, number, comment)
+	success := bot.cli.RemovePRLabels(org, repo, number, escapedLabels)
+	bot.audit(report.auditRecord(auditTargetPR, auditActionRemove, removeLabels, success))
+	if success {
+		report.Removed = append(report.Removed, removeLabels...)
+		return
 	}
+	report.RemoveFailed = append(report.RemoveFailed, removeLabels...)
+	report.fail(templateCommentUpdateLabelFailed, report.withLabels(removeLabels))
 }
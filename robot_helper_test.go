@@ -15,6 +15,8 @@ package main
 
 import (
 	"github.com/opensourceways/robot-framework-lib/client"
+	"github.com/opensourceways/robot-framework-lib/framework"
+	"github.com/opensourceways/server-common-lib/config"
 	"github.com/stretchr/testify/assert"
 	"testing"
 
@@ -36,19 +38,27 @@ type mockClient struct {
 	successfulGetRepoIssueLabels             bool
 	successfulCreateIssueComment             bool
 	successfulCheckPermission                bool
+	successfulGetPullRequestChanges          bool
 	permission                               bool
 	method                                   string
+	reaction                                 string
+	comment                                  string
+	commentID                                string
+	comments                                 []client.PRComment
 	commits                                  []client.PRCommit
+	changes                                  []client.CommitFile
 	labels                                   []string
 }
 
 func (m *mockClient) CreatePRComment(org, repo, number, comment string) bool {
 	m.method = "CreatePRComment"
+	m.comment = comment
 	return m.successfulCreatePRComment
 }
 
 func (m *mockClient) CreateIssueComment(org, repo, number, comment string) bool {
 	m.method = "CreateIssueComment"
+	m.comment = comment
 	return m.successfulCreateIssueComment
 }
 
@@ -92,7 +102,7 @@ func (m *mockClient) GetPullRequestLabels(org, repo, number string) ([]string, b
 	return m.labels, m.successfulGetPullRequestLabels
 }
 
-func (m *mockClient) GetIssueLabels(org, issueID string) ([]string, bool) {
+func (m *mockClient) GetIssueLabels(org, repo, number, issueID string) ([]string, bool) {
 	m.method = "GetIssueLabels"
 	return m.labels, m.successfulGetIssueLabels
 }
@@ -107,6 +117,34 @@ func (m *mockClient) CheckPermission(org, repo, username string) (bool, bool) {
 	return m.permission, m.successfulCheckPermission
 }
 
+func (m *mockClient) CreatePRCommentReaction(org, repo, commentID, reaction string) bool {
+	m.method = "CreatePRCommentReaction"
+	m.reaction = reaction
+	return true
+}
+
+func (m *mockClient) CreateIssueCommentReaction(org, repo, commentID, reaction string) bool {
+	m.method = "CreateIssueCommentReaction"
+	m.reaction = reaction
+	return true
+}
+
+func (m *mockClient) ListBotPRComments(org, repo, number string) ([]client.PRComment, bool) {
+	m.method = "ListBotPRComments"
+	return m.comments, true
+}
+
+func (m *mockClient) UpdatePRComment(org, repo, commentID, comment string) bool {
+	m.method = "UpdatePRComment"
+	m.commentID, m.comment = commentID, comment
+	return true
+}
+
+func (m *mockClient) GetPullRequestChanges(org, repo, number string) ([]client.CommitFile, bool) {
+	m.method = "GetPullRequestChanges"
+	return m.changes, m.successfulGetPullRequestChanges
+}
+
 const (
 	org       = "org1"
 	repo      = "repo1"
@@ -118,71 +156,79 @@ const (
 func TestRemovePRLabels(t *testing.T) {
 
 	mc := new(mockClient)
-	bot := &robot{cli: mc, cnf: &configuration{
-		CommentUpdateLabelFailed: "%s, 1123, %s",
-	}}
+	bot := &robot{cli: mc, cnf: &configuration{CommentTemplates: CommentTemplates{
+		CommentUpdateLabelFailed: "{{.Commenter}}, 1123, {{join .Labels \", \"}}",
+	}}}
 
 	cli, ok := bot.cli.(*mockClient)
 	assert.Equal(t, true, ok)
 	case1 := "No labels to remove"
 	cli.method = case1
+	report := &commandReport{commentData: commentData{Commenter: commenter}}
 	// No labels to remove
-	bot.removePRLabels(org, repo, number, commenter, []string{})
+	bot.removePRLabels(org, repo, number, []string{}, report)
 	assert.Equal(t, case1, cli.method)
+	assert.Equal(t, false, report.handled())
 
 	case2 := "RemovePRLabels"
 	cli.method = case2
 	cli.successfulRemovePRLabels = true
 	// Successfully remove labels
-	bot.removePRLabels(org, repo, number, commenter, []string{label})
+	bot.removePRLabels(org, repo, number, []string{label}, report)
 	assert.Equal(t, case2, cli.method)
+	assert.Equal(t, []string{label}, report.Removed)
+	assert.Equal(t, false, report.failed())
 
-	case3 := "CreatePRComment"
-	cli.method = case3
 	cli.successfulRemovePRLabels = false
 	// Failed to remove labels
-	bot.removePRLabels(org, repo, number, commenter, []string{label})
-	assert.Equal(t, case3, cli.method)
+	bot.removePRLabels(org, repo, number, []string{label}, report)
+	assert.Equal(t, case2, cli.method)
+	assert.Equal(t, []string{label}, report.RemoveFailed)
+	assert.Equal(t, []reportFailure{{templateCommentUpdateLabelFailed, report.withLabels([]string{label})}}, report.failures)
 
 }
 
 func TestAddLabels(t *testing.T) {
 
 	mc := new(mockClient)
-	bot := &robot{cli: mc, cnf: &configuration{
-		CommentUpdateLabelFailed: "%s, 1123, %s",
-	}}
+	bot := &robot{cli: mc, cnf: &configuration{CommentTemplates: CommentTemplates{
+		CommentUpdateLabelFailed: "{{.Commenter}}, 1123, {{join .Labels \", \"}}",
+	}}}
 
 	cli, ok := bot.cli.(*mockClient)
 	assert.Equal(t, true, ok)
 	case1 := "No labels to add"
 	cli.method = case1
+	report := &commandReport{commentData: commentData{Commenter: commenter}}
 	// No labels to add
-	bot.addPRLabels(org, repo, number, commenter, []string{})
+	bot.addPRLabels(org, repo, number, []string{}, report)
 	assert.Equal(t, case1, cli.method)
+	assert.Equal(t, false, report.handled())
 
 	case2 := "AddPRLabels"
 	cli.method = case2
 	cli.successfulAddPRLabels = true
 	// Successfully add labels
-	bot.addPRLabels(org, repo, number, commenter, []string{label})
+	bot.addPRLabels(org, repo, number, []string{label}, report)
 	assert.Equal(t, case2, cli.method)
+	assert.Equal(t, []string{label}, report.Added)
+	assert.Equal(t, false, report.failed())
 
-	case3 := "CreatePRComment"
-	cli.method = case3
 	cli.successfulAddPRLabels = false
 	// Failed to add labels
-	bot.addPRLabels(org, repo, number, commenter, []string{label})
-	assert.Equal(t, case3, cli.method)
+	bot.addPRLabels(org, repo, number, []string{label}, report)
+	assert.Equal(t, case2, cli.method)
+	assert.Equal(t, []string{label}, report.AddFailed)
+	assert.Equal(t, true, report.failed())
 
 }
 
 func TestClearLabelWhenPRSourceCodeUpdated(t *testing.T) {
 
 	mc := new(mockClient)
-	bot := &robot{cli: mc, cnf: &configuration{
-		CommentRemoveLabelsWhenPRSourceCodeUpdated: "1123, %s",
-	}}
+	bot := &robot{cli: mc, cnf: &configuration{CommentTemplates: CommentTemplates{
+		CommentRemoveLabelsWhenPRSourceCodeUpdated: "1123, {{join .Labels \", \"}}",
+	}}}
 
 	cli, ok := bot.cli.(*mockClient)
 	assert.Equal(t, true, ok)
@@ -228,6 +274,77 @@ func TestClearLabelWhenPRSourceCodeUpdated(t *testing.T) {
 	assert.Equal(t, case6, cli.method)
 }
 
+func TestClearLabelsByPatterns(t *testing.T) {
+	cli := &mockClient{
+		successfulCheckIfPRSourceCodeUpdateEvent: true,
+		successfulGetPullRequestLabels:           true,
+		successfulRemovePRLabels:                 true,
+	}
+	bot := &robot{cli: cli, cnf: &configuration{CommentTemplates: CommentTemplates{
+		CommentRemoveLabelsWhenPRSourceCodeUpdated: "removes {{join .Labels \", \"}}",
+	}}}
+
+	cnf := &repoConfig{
+		RepoFilter:                  config.RepoFilter{Repos: []string{org}},
+		ClearLabelsPatterns:         []string{"lgtm*", "*/approved"},
+		ExcludedClearLabelsPatterns: []string{"lgtm-docs"},
+		ClearLabelsPatternSyntax:    patternSyntaxGlob,
+	}
+	assert.Nil(t, cnf.validateRepoConfig())
+
+	testCases := []struct {
+		labels  []string
+		comment string
+	}{
+		{[]string{"lgtm-docs", "kind/bug"}, ""},
+		{[]string{"lgtm-docs", "lgtm-sig"}, "removes lgtm-sig"},
+		{[]string{"kind/bug", "sig/approved"}, "removes sig/approved"},
+	}
+	for i := range testCases {
+		cli.labels = testCases[i].labels
+		cli.comment = ""
+		bot.clearLabelWhenPRSourceCodeUpdated(org, repo, number, cnf, &client.GenericEvent{})
+		assert.Equal(t, testCases[i].comment, cli.comment)
+	}
+}
+
+func TestKeepLabelsForTrustedPusher(t *testing.T) {
+	cli := &mockClient{
+		successfulCheckIfPRSourceCodeUpdateEvent: true,
+		successfulGetPullRequestLabels:           true,
+		successfulRemovePRLabels:                 true,
+		successfulCheckPermission:                true,
+		labels:                                   []string{label},
+	}
+	bot := &robot{cli: cli, log: framework.NewLogger(), cnf: &configuration{CommentTemplates: CommentTemplates{
+		UserMarkFormat: "@{{.Commenter}}",
+		CommentRemoveLabelsWhenPRSourceCodeUpdated: "removes {{join .Labels \", \"}}",
+	}}}
+	cnf := &repoConfig{ClearLabels: []string{label}, TrustedPushers: []string{"Maintainer1"}}
+
+	push := func(pusher string) string {
+		cli.method, cli.comment = "", ""
+		bot.clearLabelWhenPRSourceCodeUpdated(org, repo, number, cnf, &client.GenericEvent{Author: &pusher})
+		return cli.comment
+	}
+
+	assert.Equal(t, "removes "+label, push(commenter))
+	assert.Equal(t, "### Notification  \n\nThis pull request source branch is updated by @maintainer1 who is trusted, "+
+		"so keeps the following label(s): "+label+".", push("maintainer1"))
+
+	// the collaborators are trusted
+	cnf.TrustCollaborators = true
+	cli.permission = true
+	assert.Contains(t, push(commenter), "updated by @"+commenter+" who is trusted")
+	cli.permission = false
+	assert.Equal(t, "removes "+label, push(commenter))
+
+	// the repository overrides the note
+	cnf.CommentKeepLabelsForTrustedPusher = "{{.Commenter}} keeps {{join .Labels \", \"}}"
+	assert.Nil(t, cnf.parseTemplates())
+	assert.Equal(t, "@maintainer1 keeps "+label, push("maintainer1"))
+}
+
 func TestHandleSquashLabel(t *testing.T) {
 	mc := new(mockClient)
 	bot := &robot{cli: mc, cnf: &configuration{}}
@@ -284,3 +401,113 @@ func TestHandleSquashLabel(t *testing.T) {
 	bot.handleSquashLabel(org, repo, number, cnf)
 	assert.Equal(t, case5, cli.method)
 }
+
+func TestSendPRReport(t *testing.T) {
+	mc := new(mockClient)
+	bot := &robot{cli: mc, cnf: &configuration{CommentTemplates: CommentTemplates{
+		CommentUpdateLabelFailed: "failed",
+	}}}
+
+	cli, ok := bot.cli.(*mockClient)
+	assert.Equal(t, true, ok)
+
+	case1 := "Nothing is done by the command"
+	cli.method = case1
+	bot.sendPRReport(org, repo, number, feedback{&repoConfig{FeedbackMode: feedbackModeBoth}, "1"}, &commandReport{})
+	assert.Equal(t, case1, cli.method)
+
+	succeeded := &commandReport{Added: []string{label}}
+	failed := &commandReport{RemoveFailed: []string{label}}
+	failed.fail(templateCommentUpdateLabelFailed, failed.withLabels([]string{label}))
+
+	// Successfully add labels, and nothing to respond in the comment mode
+	bot.sendPRReport(org, repo, number, feedback{&repoConfig{FeedbackMode: feedbackModeComment}, "1"}, succeeded)
+	assert.Equal(t, case1, cli.method)
+
+	case2 := "CreatePRCommentReaction"
+	// Successfully add labels, and react to the comment in the reaction mode
+	bot.sendPRReport(org, repo, number, feedback{&repoConfig{FeedbackMode: feedbackModeReaction}, "1"}, succeeded)
+	assert.Equal(t, case2, cli.method)
+	assert.Equal(t, reactionSuccess, cli.reaction)
+
+	cli.method = case1
+	// Failed to remove labels, and only react to the comment in the reaction mode
+	bot.sendPRReport(org, repo, number, feedback{&repoConfig{FeedbackMode: feedbackModeReaction}, "1"}, failed)
+	assert.Equal(t, case2, cli.method)
+	assert.Equal(t, reactionFailure, cli.reaction)
+
+	case4 := "CreatePRComment"
+	cli.reaction = ""
+	// Failed to remove labels, react to the comment and comment in the both mode
+	bot.sendPRReport(org, repo, number, feedback{&repoConfig{FeedbackMode: feedbackModeBoth}, "1"}, failed)
+	assert.Equal(t, case4, cli.method)
+	assert.Equal(t, reactionFailure, cli.reaction)
+	assert.Equal(t, "failed\n\n"+commandReportMarker, cli.comment)
+
+	cli.method = case1
+	cli.reaction = ""
+	// Failed to remove labels, but respond nothing in the none mode
+	bot.sendPRReport(org, repo, number, feedback{&repoConfig{FeedbackMode: feedbackModeNone}, "1"}, failed)
+	assert.Equal(t, case1, cli.method)
+	assert.Equal(t, "", cli.reaction)
+
+	// Failed to remove labels, but there is no previous report to edit
+	bot.sendPRReport(org, repo, number, feedback{repoCnf: &repoConfig{FeedbackMode: feedbackModeComment, EditPreviousFeedback: true}}, failed)
+	assert.Equal(t, case4, cli.method)
+
+	case7 := "UpdatePRComment"
+	cli.comments = []client.PRComment{
+		{ID: "11", Body: "old report\n\n" + commandReportMarker},
+		{ID: "12", Body: "/kind bug"},
+	}
+	// Failed to remove labels, and edit the previous report
+	bot.sendPRReport(org, repo, number, feedback{repoCnf: &repoConfig{FeedbackMode: feedbackModeComment, EditPreviousFeedback: true}}, failed)
+	assert.Equal(t, case7, cli.method)
+	assert.Equal(t, "11", cli.commentID)
+}
+
+func TestSendIssueReport(t *testing.T) {
+	mc := new(mockClient)
+	bot := &robot{cli: mc, cnf: &configuration{
+		CommentTemplates: CommentTemplates{
+			CommentUpdateLabelFailed: "a",
+			CommentAddNotExistLabel:  "b",
+		},
+		Locales: map[string]CommentTemplates{
+			"zh": {
+				UserMarkFormat:                             "@{{.Commenter}}",
+				CommentCommandTrigger:                      "c",
+				CommentLabelCommandConflict:                "d",
+				CommentUpdateLabelFailed:                   "e",
+				CommentAddNotExistLabel:                    "f",
+				CommentRemoveLabelsWhenPRSourceCodeUpdated: "g",
+			},
+		},
+	}}
+
+	cli, ok := bot.cli.(*mockClient)
+	assert.Equal(t, true, ok)
+
+	report := &commandReport{AddFailed: []string{label}}
+	report.fail(templateCommentUpdateLabelFailed, report.withLabels([]string{label}))
+	report.fail(templateCommentAddNotExistLabel, report.withLabels([]string{label}))
+
+	case1 := "CreateIssueComment"
+	// Failed to add labels, react to the comment and comment in the both mode
+	bot.sendIssueReport(org, repo, number, feedback{&repoConfig{FeedbackMode: feedbackModeBoth}, "1"}, report)
+	assert.Equal(t, case1, cli.method)
+	assert.Equal(t, reactionFailure, cli.reaction)
+	assert.Equal(t, "a\n\n---\n\nb\n\n"+commandReportMarker, cli.comment)
+
+	// Failed to add labels, and comment in two locales
+	bot.sendIssueReport(org, repo, number,
+		feedback{repoCnf: &repoConfig{Locales: []string{"zh", defaultLocale}}}, report)
+	assert.Equal(t, "e\n\n---\n\nf\n\n---\n\na\n\n---\n\nb\n\n"+commandReportMarker, cli.comment)
+
+	case2 := "CreateIssueCommentReaction"
+	// Successfully add labels, but the comment id is unknown
+	bot.sendIssueReport(org, repo, number, feedback{&repoConfig{FeedbackMode: feedbackModeBoth}, "1"},
+		&commandReport{Added: []string{label}})
+	assert.Equal(t, case2, cli.method)
+	assert.Equal(t, reactionSuccess, cli.reaction)
+}
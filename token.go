@@ -0,0 +1,245 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/opensourceways/robot-framework-lib/client"
+	"github.com/opensourceways/server-common-lib/secret"
+	"github.com/sirupsen/logrus"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+)
+
+// the sources of the token
+const (
+	// tokenSourceFile loads the token file once at startup, it is deleted afterwards if del-token is true
+	tokenSourceFile = "file"
+	// tokenSourceWatch watches the token file, e.g. a mounted secret which is rotated
+	tokenSourceWatch = "watch"
+	// tokenSourceCommand runs an external credential command which prints the token
+	tokenSourceCommand = "command"
+)
+
+// tokenSource loads the token from the file or the credential command
+type tokenSource struct {
+	kind    string
+	path    string
+	command string
+
+	// lock serializes the refreshes, digest is the digest of the token loaded last
+	lock   sync.Mutex
+	digest [sha256.Size]byte
+}
+
+func newTokenSource(kind, path, command string) (*tokenSource, error) {
+	switch kind {
+	case tokenSourceFile, tokenSourceWatch:
+		if path == "" {
+			return nil, errors.New("missing the token path of the token source " + kind)
+		}
+	case tokenSourceCommand:
+		if command == "" {
+			return nil, errors.New("missing the credential command of the token source command")
+		}
+	default:
+		return nil, errors.New("unsupported token source: " + kind)
+	}
+
+	return &tokenSource{kind: kind, path: path, command: command}, nil
+}
+
+// rotates returns true if the token may change while the bot is running
+func (s *tokenSource) rotates() bool {
+	return s.kind != tokenSourceFile
+}
+
+func (s *tokenSource) load() ([]byte, error) {
+	var token []byte
+	if s.kind == tokenSourceCommand {
+		out, err := exec.Command("sh", "-c", s.command).Output()
+		if err != nil {
+			return nil, fmt.Errorf("the credential command failed: %w", err)
+		}
+		token = bytes.TrimSpace(out)
+	} else {
+		var err error
+		if token, err = secret.LoadSingleSecret(s.path); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(token) == 0 {
+		return nil, errors.New("the token is empty")
+	}
+
+	return token, nil
+}
+
+// refresh loads the token, changed is true if it differs from the one loaded last time
+func (s *tokenSource) refresh() (token []byte, changed bool, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if token, err = s.load(); err != nil {
+		return nil, false, err
+	}
+
+	digest := sha256.Sum256(token)
+	changed = digest != s.digest
+	s.digest = digest
+
+	return token, changed, nil
+}
+
+// rotatingClient delegates the calls to the client of the current token,
+// the client is swapped atomically when the token is rotated, the calls in flight finish with the old one.
+type rotatingClient struct {
+	current atomic.Pointer[clientRef]
+}
+
+type clientRef struct {
+	iClient
+}
+
+func newRotatingClient(cli iClient) *rotatingClient {
+	c := &rotatingClient{}
+	c.swap(cli)
+
+	return c
+}
+
+func (c *rotatingClient) swap(cli iClient) {
+	c.current.Store(&clientRef{iClient: cli})
+}
+
+func (c *rotatingClient) get() iClient {
+	return c.current.Load().iClient
+}
+
+func (c *rotatingClient) CreatePRComment(org, repo, number, comment string) bool {
+	return c.get().CreatePRComment(org, repo, number, comment)
+}
+
+func (c *rotatingClient) CreateIssueComment(org, repo, number, comment string) bool {
+	return c.get().CreateIssueComment(org, repo, number, comment)
+}
+
+func (c *rotatingClient) AddIssueLabels(org, repo, number string, labels []string) bool {
+	return c.get().AddIssueLabels(org, repo, number, labels)
+}
+
+func (c *rotatingClient) RemoveIssueLabels(org, repo, number string, labels []string) bool {
+	return c.get().RemoveIssueLabels(org, repo, number, labels)
+}
+
+func (c *rotatingClient) AddPRLabels(org, repo, number string, labels []string) bool {
+	return c.get().AddPRLabels(org, repo, number, labels)
+}
+
+func (c *rotatingClient) RemovePRLabels(org, repo, number string, labels []string) bool {
+	return c.get().RemovePRLabels(org, repo, number, labels)
+}
+
+func (c *rotatingClient) CheckIfPRCreateEvent(evt *client.GenericEvent) bool {
+	return c.get().CheckIfPRCreateEvent(evt)
+}
+
+func (c *rotatingClient) CheckIfPRSourceCodeUpdateEvent(evt *client.GenericEvent) bool {
+	return c.get().CheckIfPRSourceCodeUpdateEvent(evt)
+}
+
+func (c *rotatingClient) GetPullRequestCommits(org, repo, number string) ([]client.PRCommit, bool) {
+	return c.get().GetPullRequestCommits(org, repo, number)
+}
+
+func (c *rotatingClient) GetPullRequestLabels(org, repo, number string) ([]string, bool) {
+	return c.get().GetPullRequestLabels(org, repo, number)
+}
+
+func (c *rotatingClient) GetIssueLabels(org, repo, number, issueID string) ([]string, bool) {
+	return c.get().GetIssueLabels(org, repo, number, issueID)
+}
+
+func (c *rotatingClient) GetRepoIssueLabels(org, repo string) ([]string, bool) {
+	return c.get().GetRepoIssueLabels(org, repo)
+}
+
+func (c *rotatingClient) CheckPermission(org, repo, username string) (bool, bool) {
+	return c.get().CheckPermission(org, repo, username)
+}
+
+func (c *rotatingClient) CreatePRCommentReaction(org, repo, commentID, reaction string) bool {
+	return c.get().CreatePRCommentReaction(org, repo, commentID, reaction)
+}
+
+func (c *rotatingClient) CreateIssueCommentReaction(org, repo, commentID, reaction string) bool {
+	return c.get().CreateIssueCommentReaction(org, repo, commentID, reaction)
+}
+
+func (c *rotatingClient) ListBotPRComments(org, repo, number string) ([]client.PRComment, bool) {
+	return c.get().ListBotPRComments(org, repo, number)
+}
+
+func (c *rotatingClient) UpdatePRComment(org, repo, commentID, comment string) bool {
+	return c.get().UpdatePRComment(org, repo, commentID, comment)
+}
+
+func (c *rotatingClient) GetPullRequestChanges(org, repo, number string) ([]client.CommitFile, bool) {
+	return c.get().GetPullRequestChanges(org, repo, number)
+}
+
+// rotateToken swaps the client for the token of the source if the token changed
+func (bot *robot) rotateToken(src *tokenSource) {
+	bot.rotateClient(src, "", bot.rotating, bot.log)
+}
+
+// rotateClient swaps the client of cli for the token of the source of the credential if the token changed
+func (bot *robot) rotateClient(src *tokenSource, credential string, cli *rotatingClient, log *logrus.Entry) {
+	token, changed, err := src.refresh()
+	if err != nil {
+		log.WithError(err).Error("failed to refresh the token, keep using the current one")
+		return
+	}
+	if !changed {
+		return
+	}
+
+	next := bot.clientOf(credential, token)
+	if err = validateClient(next); err != nil {
+		log.WithError(err).Error("failed to create the client of the rotated token, keep using the current one")
+		return
+	}
+	cli.swap(next)
+	log.Info("the token is rotated")
+}
+
+// clientValidator is implemented by the clients which can be created broken, e.g. the GitCode client
+// is not created if the platform rejects the token or can not be reached.
+type clientValidator interface {
+	validate() error
+}
+
+// validateClient returns an error if the client is broken, the clients which can not be broken are valid
+func validateClient(cli iClient) error {
+	if v, ok := cli.(clientValidator); ok {
+		return v.validate()
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"errors"
+	"github.com/opensourceways/robot-framework-lib/framework"
+	"github.com/opensourceways/robot-universal-label/fakeclient"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotateToken(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "token")
+	assert.Nil(t, os.WriteFile(file, []byte("token1\n"), 0o600))
+	src, err := newTokenSource(tokenSourceWatch, file, "")
+	assert.Nil(t, err)
+	assert.True(t, src.rotates())
+
+	clients := map[string]*fakeclient.Client{"token1": fakeclient.New(), "token2": fakeclient.New()}
+	for _, c := range clients {
+		c.AddRepo(org, repo)
+	}
+	broken := map[string]bool{}
+	bot := &robot{log: framework.NewLogger(), clientOf: func(_ string, token []byte) iClient {
+		if broken[string(token)] {
+			return brokenClient{clients[string(token)]}
+		}
+		return clients[string(token)]
+	}}
+
+	token, changed, err := src.refresh()
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	bot.rotating = newRotatingClient(bot.clientOf("", token))
+
+	// the token does not change
+	bot.rotateToken(src)
+	bot.rotating.GetRepoIssueLabels(org, repo)
+	assert.Equal(t, 1, len(clients["token1"].Calls()))
+
+	// the token is rotated, the calls go to the client of the new token
+	assert.Nil(t, os.WriteFile(file, []byte("token2"), 0o600))
+	bot.rotateToken(src)
+	bot.rotating.GetRepoIssueLabels(org, repo)
+	assert.Equal(t, 1, len(clients["token1"].Calls()))
+	assert.Equal(t, 1, len(clients["token2"].Calls()))
+
+	// the client of the new token is broken, the current one is kept
+	clients["token3"] = fakeclient.New()
+	broken["token3"] = true
+	assert.Nil(t, os.WriteFile(file, []byte("token3"), 0o600))
+	bot.rotateToken(src)
+	bot.rotating.GetRepoIssueLabels(org, repo)
+	assert.Equal(t, 2, len(clients["token2"].Calls()))
+	assert.Equal(t, 0, len(clients["token3"].Calls()))
+
+	// the token can not be loaded, the current one is kept
+	assert.Nil(t, os.WriteFile(file, nil, 0o600))
+	bot.rotateToken(src)
+	bot.rotating.GetRepoIssueLabels(org, repo)
+	assert.Equal(t, 3, len(clients["token2"].Calls()))
+
+	// the GitCode client is not created if the token is rejected
+	limit := newRateLimits(10, time.Hour, 0.1, nil).of("")
+	assert.NotNil(t, validateClient(&platformClient{
+		platforms: func() []string { return []string{platformGitCode} },
+		create:    func(string) iClient { return newRateLimitedClient(&gitcodeClient{limit: limit}, limit) },
+		clients:   map[string]iClient{},
+	}))
+}
+
+// brokenClient is a client which fails to be created
+type brokenClient struct {
+	*fakeclient.Client
+}
+
+func (c brokenClient) validate() error {
+	return errors.New("broken")
+}
+
+func TestTokenSource(t *testing.T) {
+	src, err := newTokenSource(tokenSourceCommand, "", "echo ' token1 '")
+	assert.Nil(t, err)
+	token, changed, err := src.refresh()
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "token1", string(token))
+	_, changed, _ = src.refresh()
+	assert.False(t, changed)
+
+	src, _ = newTokenSource(tokenSourceCommand, "", "exit 1")
+	_, _, err = src.refresh()
+	assert.ErrorContains(t, err, "the credential command failed")
+
+	_, err = newTokenSource(tokenSourceCommand, "", "")
+	assert.EqualError(t, err, "missing the credential command of the token source command")
+	_, err = newTokenSource(tokenSourceWatch, "", "")
+	assert.EqualError(t, err, "missing the token path of the token source watch")
+	_, err = newTokenSource("vault", "", "")
+	assert.EqualError(t, err, "unsupported token source: vault")
+
+	src, _ = newTokenSource(tokenSourceFile, "/token", "")
+	assert.False(t, src.rotates())
+}
@@ -0,0 +1,119 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/opensourceways/robot-framework-lib/client"
+	"github.com/opensourceways/robot-framework-lib/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+)
+
+const tracerName = "github.com/opensourceways/robot-universal-label"
+
+// the exporters of the spans
+const (
+	traceExporterNone = "none"
+	// traceExporterOTLP exports to the collector configured by the OTEL_EXPORTER_OTLP_* environment variables
+	traceExporterOTLP = "otlp"
+	// traceExporterFile writes the spans as json to a local file
+	traceExporterFile = "file"
+)
+
+// the attributes of the spans
+const (
+	attributeOrg    = attribute.Key("label.org")
+	attributeRepo   = attribute.Key("label.repo")
+	attributeNumber = attribute.Key("label.number")
+	attributeEvent  = attribute.Key("label.event")
+)
+
+// newTracerProvider creates the provider exporting the spans by the exporter,
+// it returns nil if the exporter is none or empty, the spans are discarded then.
+// The file of the file exporter is returned as well, it is closed after the provider is shut down.
+func newTracerProvider(exporter, file string) (*sdktrace.TracerProvider, *os.File, error) {
+	var e sdktrace.SpanExporter
+	var f *os.File
+	var err error
+	switch exporter {
+	case "", traceExporterNone:
+		return nil, nil, nil
+	case traceExporterOTLP:
+		e, err = otlptracehttp.New(context.Background())
+	case traceExporterFile:
+		if file == "" {
+			return nil, nil, errors.New("missing the file of the trace exporter")
+		}
+		if f, err = os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600); err == nil {
+			if e, err = stdouttrace.New(stdouttrace.WithWriter(f)); err != nil {
+				_ = f.Close()
+			}
+		}
+	default:
+		return nil, nil, errors.New("unsupported trace exporter: " + exporter)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(e),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(component))),
+	), f, nil
+}
+
+// startEventSpan starts the span of handling the event, and returns a copy of the bot
+// whose calls to the client are traced as the children of the span.
+func (bot *robot) startEventSpan(name, eventType string, evt *client.GenericEvent) (*robot, trace.Span) {
+	ctx, span := otel.Tracer(tracerName).Start(context.Background(), name, trace.WithAttributes(
+		attributeEvent.String(eventType),
+		attributeOrg.String(utils.GetString(evt.Org)),
+		attributeRepo.String(utils.GetString(evt.Repo)),
+		attributeNumber.String(utils.GetString(evt.Number)),
+	))
+
+	traced := *bot
+	traced.cli = withTraceContext(bot.cli, ctx)
+
+	return &traced, span
+}
+
+// withTraceContext returns a copy of the client whose calls are traced under ctx
+func withTraceContext(cli iClient, ctx context.Context) iClient {
+	switch c := cli.(type) {
+	case *instrumentedClient:
+		tc := *c
+		tc.ctx = ctx
+		return &tc
+	case *cachingClient:
+		cc := *c
+		cc.iClient = withTraceContext(c.iClient, ctx)
+		return &cc
+	case *dryRunClient:
+		dc := *c
+		dc.iClient = withTraceContext(c.iClient, ctx)
+		return &dc
+	}
+
+	return cli
+}
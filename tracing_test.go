@@ -0,0 +1,90 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2024. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"github.com/opensourceways/robot-framework-lib/client"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTraceEventHandling(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(prev)
+
+	bot, cli := botHelper(t)
+	bot.cli = &instrumentedClient{iClient: cli}
+	cli.successfulGetRepoIssueLabels = true
+	cli.successfulGetPullRequestLabels = true
+	cli.successfulRemovePRLabels = true
+	cli.labels = []string{"kind/bug"}
+
+	evtOrg, evtRepo, evtNo, evtComment := "owner2", "repo1", number, "/remove-kind bug"
+	evt := &client.GenericEvent{Org: &evtOrg, Repo: &evtRepo, Number: &evtNo, Comment: &evtComment}
+	bot.handlePullRequestCommentEvent(evt, nil, bot.log)
+
+	spans := recorder.Ended()
+	assert.Equal(t, 5, len(spans))
+	root := spans[len(spans)-1]
+	assert.Equal(t, "handlePullRequestCommentEvent", root.Name())
+	assert.ElementsMatch(t, []attribute.KeyValue{
+		attributeEvent.String(eventTypePullRequestComment),
+		attributeOrg.String("owner2"), attributeRepo.String("repo1"), attributeNumber.String(number),
+	}, root.Attributes())
+
+	names := make([]string, 0, len(spans)-1)
+	for _, s := range spans[:len(spans)-1] {
+		assert.Equal(t, root.SpanContext().SpanID(), s.Parent().SpanID())
+		names = append(names, s.Name())
+		if s.Name() == "iClient.CheckPermission" {
+			assert.Equal(t, codes.Error, s.Status().Code)
+		}
+	}
+	assert.Equal(t, []string{"iClient.GetRepoIssueLabels", "iClient.CheckPermission",
+		"iClient.GetPullRequestLabels", "iClient.RemovePRLabels"}, names)
+}
+
+func TestNewTracerProvider(t *testing.T) {
+	tp, f, err := newTracerProvider(traceExporterNone, "")
+	assert.Nil(t, tp)
+	assert.Nil(t, f)
+	assert.Nil(t, err)
+	_, _, err = newTracerProvider(traceExporterFile, "")
+	assert.EqualError(t, err, "missing the file of the trace exporter")
+	_, _, err = newTracerProvider("zipkin", "")
+	assert.EqualError(t, err, "unsupported trace exporter: zipkin")
+
+	file := filepath.Join(t.TempDir(), "spans.json")
+	tp, f, err = newTracerProvider(traceExporterFile, file)
+	assert.Nil(t, err)
+	_, span := tp.Tracer(tracerName).Start(context.Background(), "handlePullRequestEvent")
+	span.End()
+	assert.Nil(t, tp.Shutdown(context.Background()))
+	// the file is kept open until it is closed after the shutdown
+	assert.Nil(t, f.Close())
+
+	b, err := os.ReadFile(file)
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), `"Name":"handlePullRequestEvent"`)
+}